@@ -2,33 +2,47 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	grpcAuth "github.com/christmas-fire/nexus/internal/controller/grpc/auth"
 	grpcChat "github.com/christmas-fire/nexus/internal/controller/grpc/chat"
 	"github.com/christmas-fire/nexus/internal/controller/grpc/interceptors"
+	grpcModeration "github.com/christmas-fire/nexus/internal/controller/grpc/moderation"
+	grpcUser "github.com/christmas-fire/nexus/internal/controller/grpc/user"
 	"github.com/christmas-fire/nexus/internal/controller/rest"
 	"github.com/christmas-fire/nexus/internal/controller/ws"
 
 	"github.com/christmas-fire/nexus/internal/repository/chat"
+	moderationRepo "github.com/christmas-fire/nexus/internal/repository/moderation"
 	userRepo "github.com/christmas-fire/nexus/internal/repository/user"
 
 	authService "github.com/christmas-fire/nexus/internal/service/auth"
 	chatService "github.com/christmas-fire/nexus/internal/service/chat"
+	"github.com/christmas-fire/nexus/internal/service/events"
+	"github.com/christmas-fire/nexus/internal/service/filter"
+	moderationService "github.com/christmas-fire/nexus/internal/service/moderation"
+	"github.com/christmas-fire/nexus/internal/service/preview"
+	userService "github.com/christmas-fire/nexus/internal/service/user"
 
 	"github.com/christmas-fire/nexus/internal/storage/postgres"
 	"github.com/christmas-fire/nexus/internal/storage/redis"
 
 	authv1 "github.com/christmas-fire/nexus/pkg/auth/v1"
 	chatv1 "github.com/christmas-fire/nexus/pkg/chat/v1"
+	moderationv1 "github.com/christmas-fire/nexus/pkg/moderation/v1"
+	userv1 "github.com/christmas-fire/nexus/pkg/user/v1"
 
+	goredis "github.com/redis/go-redis/v9"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
@@ -62,25 +76,44 @@ func main() {
 	}
 
 	userRepository := userRepo.NewPostgresRepository(dbPool)
-	chRepository := chat.NewPostgresRepository(dbPool)
+	chRepository := chat.NewPostgresRepository(dbPool, os.Getenv("SEARCH_LANGUAGE"))
+	modRepository := moderationRepo.NewPostgresRepository(dbPool)
 
 	authenticationService := authService.NewAuthService(userRepository, jwtSecret, tokenTTL)
-	chService := chatService.NewChatService(chRepository, redisClient)
+	messageFilters, err := newMessageFilters(redisClient, modRepository)
+	if err != nil {
+		log.Fatalf("failed to configure message filters: %v", err)
+	}
+	eventBus, err := newEventBus(redisClient)
+	if err != nil {
+		log.Fatalf("failed to configure event bus: %v", err)
+	}
+	eventJournal := events.NewJournal(redisClient, events.JournalOptions{})
+	membershipCache := events.NewMembershipCache(redisClient, chRepository, events.MembershipOptions{})
+	go membershipCache.Run(ctx)
+	eventPublisher := events.NewPublisher(eventBus, membershipCache, eventJournal)
+	chService := chatService.NewChatService(chRepository, redisClient, messageFilters, eventPublisher)
+	usService := userService.NewUserService(userRepository)
+	modService := moderationService.NewModerationService(modRepository, chRepository, eventPublisher)
 
 	grpcServer := grpc.NewServer(
 		grpc.ChainUnaryInterceptor(
-			interceptors.AuthUnaryInterceptor(jwtSecret, publicMethods),
+			interceptors.AuthUnaryInterceptor(jwtSecret, publicMethods, modService),
 		),
 		grpc.ChainStreamInterceptor(
-			interceptors.AuthStreamInterceptor(jwtSecret, publicMethods),
+			interceptors.AuthStreamInterceptor(jwtSecret, publicMethods, modService),
 		),
 	)
 
 	grpcAuthServer := grpcAuth.NewServer(authenticationService)
 	grpcChatServer := grpcChat.NewServer(chService)
+	grpcUserServer := grpcUser.NewServer(usService)
+	grpcModerationServer := grpcModeration.NewServer(modService)
 
 	authv1.RegisterAuthServiceServer(grpcServer, grpcAuthServer)
 	chatv1.RegisterChatServiceServer(grpcServer, grpcChatServer)
+	userv1.RegisterUserServiceServer(grpcServer, grpcUserServer)
+	moderationv1.RegisterModerationServiceServer(grpcServer, grpcModerationServer)
 
 	grpcConn, err := grpc.DialContext(
 		ctx,
@@ -93,21 +126,41 @@ func main() {
 	defer grpcConn.Close()
 
 	chatGrpcClient := chatv1.NewChatServiceClient(grpcConn)
+	userGrpcClient := userv1.NewUserServiceClient(grpcConn)
 
-	hub := ws.NewHub(redisClient, chRepository)
+	wsOptions, err := newWsOptions()
+	if err != nil {
+		log.Fatalf("failed to configure websocket gateway: %v", err)
+	}
+	hub := ws.NewHub(eventBus, eventJournal, modRepository, wsOptions)
 	go hub.Run()
 	go hub.SubscribeToMessages(ctx)
 
+	previewWorker := preview.NewWorker(redisClient, preview.NewUnfurler(preview.Options{}), chService)
+	go previewWorker.Run(ctx, 4)
+
+	scheduler := chatService.NewScheduler(chService, modService)
+	go scheduler.Run(ctx)
+
+	reaper := chatService.NewReaper(chService)
+	go reaper.Run(ctx)
+
+	relay := chatService.NewOutboxRelay(chService)
+	go relay.Run(ctx)
+
+	wsTickets := authService.NewTicketStore(redisClient, 30*time.Second)
+
 	httpMux := http.NewServeMux()
 
 	httpMux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		ws.ServeWs(hub, w, r, jwtSecret, chatGrpcClient)
+		ws.ServeWs(hub, w, r, authenticationService, wsTickets, chatGrpcClient, userGrpcClient)
 	})
 
-	authRestHandler := rest.NewAuthHandler(authenticationService)
+	authRestHandler := rest.NewAuthHandler(authenticationService, wsTickets)
 
 	httpMux.HandleFunc("/api/v1/register", authRestHandler.Register)
 	httpMux.HandleFunc("/api/v1/login", authRestHandler.Login)
+	httpMux.HandleFunc("/api/v1/ws-ticket", authRestHandler.WSTicket)
 
 	fileServer := http.FileServer(http.Dir("./web"))
 	httpMux.Handle("/", fileServer)
@@ -117,6 +170,18 @@ func main() {
 		Handler: httpMux,
 	}
 
+	// Process internals and gateway metrics are kept off the public port.
+	adminAddr := os.Getenv("ADMIN_ADDR")
+	if adminAddr == "" {
+		adminAddr = "127.0.0.1:8082"
+	}
+	adminMux := http.NewServeMux()
+	adminMux.Handle("/debug/vars", expvar.Handler())
+	adminServer := &http.Server{
+		Addr:    adminAddr,
+		Handler: adminMux,
+	}
+
 	errChan := make(chan error, 1)
 
 	go func() {
@@ -131,6 +196,13 @@ func main() {
 		}
 	}()
 
+	go func() {
+		log.Printf("Admin server is listening on %s", adminAddr)
+		if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errChan <- fmt.Errorf("admin server failed: %w", err)
+		}
+	}()
+
 	go func() {
 		log.Printf("WebSocket gateway is listening on :8081")
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -155,4 +227,110 @@ func main() {
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
 		log.Printf("HTTP server shutdown error: %v", err)
 	}
+	if err := adminServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("admin server shutdown error: %v", err)
+	}
+}
+
+// newEventBus picks the event bus from EVENT_BUS. "stream" (the default)
+// sends every event to every instance through a Redis stream; the
+// instance's consumer group is named after INSTANCE_ID, or the hostname, so
+// that a restarted instance catches up on the events it missed. "user"
+// routes each event only to the instances its recipients are connected to,
+// which scales better but loses the events published while an instance is
+// down; its clients have to resume from the journal.
+func newEventBus(redisClient *goredis.Client) (events.EventBus, error) {
+	switch os.Getenv("EVENT_BUS") {
+	case "user":
+		return events.NewUserChannelBus(redisClient), nil
+	case "", "stream":
+		instanceID := os.Getenv("INSTANCE_ID")
+		if instanceID == "" {
+			var err error
+			if instanceID, err = os.Hostname(); err != nil {
+				return nil, fmt.Errorf("failed to get hostname for INSTANCE_ID: %w", err)
+			}
+		}
+		return events.NewStreamBus(redisClient, events.StreamOptions{
+			Group:    "gateway:" + instanceID,
+			Consumer: instanceID,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown EVENT_BUS %q", os.Getenv("EVENT_BUS"))
+}
+
+// newWsOptions configures the WebSocket gateway from the environment:
+// WS_ALLOWED_ORIGINS is a comma-separated list of origins browsers may
+// connect from ("*" for any; by default only the gateway's own host),
+// WS_COMPRESSION enables per-message compression and WS_READ_LIMIT caps the
+// size of client messages in bytes.
+func newWsOptions() (ws.Options, error) {
+	var opts ws.Options
+	for _, origin := range strings.Split(os.Getenv("WS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			opts.AllowedOrigins = append(opts.AllowedOrigins, origin)
+		}
+	}
+	if v := os.Getenv("WS_COMPRESSION"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return ws.Options{}, fmt.Errorf("invalid WS_COMPRESSION: %w", err)
+		}
+		opts.EnableCompression = enabled
+	}
+	if v := os.Getenv("WS_READ_LIMIT"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return ws.Options{}, fmt.Errorf("invalid WS_READ_LIMIT: %w", err)
+		}
+		opts.ReadLimit = n
+	}
+	return opts, nil
+}
+
+// newMessageFilters builds the content filter chain from the environment:
+// FILTER_MAX_LENGTH and FILTER_MAX_LINES tighten the message size limits,
+// FILTER_WORDLIST names a wordlist file and FILTER_WORDLIST_ACTION picks
+// what happens to matches (mask, flag or reject; mask by default). The spam
+// filter is always on.
+func newMessageFilters(redisClient *goredis.Client, decisions filter.DecisionLog) (*filter.Pipeline, error) {
+	var maxLength, maxLines int
+	if v := os.Getenv("FILTER_MAX_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FILTER_MAX_LENGTH: %w", err)
+		}
+		maxLength = n
+	}
+	if v := os.Getenv("FILTER_MAX_LINES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FILTER_MAX_LINES: %w", err)
+		}
+		maxLines = n
+	}
+
+	filters := []filter.MessageFilter{
+		filter.NewLengthFilter(maxLength, maxLines),
+		filter.NewSpamFilter(redisClient, filter.SpamOptions{}),
+	}
+
+	if path := os.Getenv("FILTER_WORDLIST"); path != "" {
+		action := filter.Mask
+		if v := os.Getenv("FILTER_WORDLIST_ACTION"); v != "" {
+			a, err := filter.ParseAction(v)
+			if err != nil {
+				return nil, err
+			}
+			action = a
+		}
+
+		words, patterns, err := filter.LoadWordlist(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load wordlist: %w", err)
+		}
+		filters = append(filters, filter.NewWordlistFilter(words, patterns, action))
+	}
+
+	return filter.NewPipeline(decisions, filters...), nil
 }
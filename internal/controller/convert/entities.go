@@ -0,0 +1,66 @@
+// Package convert translates between the models and their chat/v1
+// protobuf counterparts for the controllers that speak both.
+package convert
+
+import (
+	"github.com/christmas-fire/nexus/internal/models"
+	chatv1 "github.com/christmas-fire/nexus/pkg/chat/v1"
+)
+
+var entityTypes = map[string]chatv1.EntityType{
+	models.EntityBold:          chatv1.EntityType_ENTITY_TYPE_BOLD,
+	models.EntityItalic:        chatv1.EntityType_ENTITY_TYPE_ITALIC,
+	models.EntityStrikethrough: chatv1.EntityType_ENTITY_TYPE_STRIKETHROUGH,
+	models.EntityCode:          chatv1.EntityType_ENTITY_TYPE_CODE,
+	models.EntityPre:           chatv1.EntityType_ENTITY_TYPE_PRE,
+	models.EntityLink:          chatv1.EntityType_ENTITY_TYPE_LINK,
+	models.EntityMention:       chatv1.EntityType_ENTITY_TYPE_MENTION,
+}
+
+// ToProtoEntities maps unknown types to ENTITY_TYPE_UNSPECIFIED, which the
+// chat service rejects.
+func ToProtoEntities(entities []models.Entity) []*chatv1.MessageEntity {
+	if len(entities) == 0 {
+		return nil
+	}
+
+	grpcEntities := make([]*chatv1.MessageEntity, 0, len(entities))
+	for _, e := range entities {
+		grpcEntities = append(grpcEntities, &chatv1.MessageEntity{
+			Type:   entityTypes[e.Type],
+			Offset: int32(e.Offset),
+			Length: int32(e.Length),
+			Url:    e.URL,
+			UserId: e.UserID,
+		})
+	}
+	return grpcEntities
+}
+
+// FromProtoEntities keeps unknown types as-is so the service can reject
+// them.
+func FromProtoEntities(grpcEntities []*chatv1.MessageEntity) []models.Entity {
+	if len(grpcEntities) == 0 {
+		return nil
+	}
+
+	entities := make([]models.Entity, 0, len(grpcEntities))
+	for _, e := range grpcEntities {
+		typ := e.GetType().String()
+		for name, t := range entityTypes {
+			if t == e.GetType() {
+				typ = name
+				break
+			}
+		}
+
+		entities = append(entities, models.Entity{
+			Type:   typ,
+			Offset: int(e.GetOffset()),
+			Length: int(e.GetLength()),
+			URL:    e.GetUrl(),
+			UserID: e.GetUserId(),
+		})
+	}
+	return entities
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"errors"
 	"log"
+	"time"
 
+	"github.com/christmas-fire/nexus/internal/controller/convert"
 	"github.com/christmas-fire/nexus/internal/controller/grpc/interceptors"
+	"github.com/christmas-fire/nexus/internal/models"
+	chatRepo "github.com/christmas-fire/nexus/internal/repository/chat"
 	chat "github.com/christmas-fire/nexus/internal/service/chat"
 	chatv1 "github.com/christmas-fire/nexus/pkg/chat/v1"
 	"google.golang.org/grpc/codes"
@@ -36,14 +40,111 @@ func (s *server) CreateChat(ctx context.Context, req *chatv1.CreateChatRequest)
 		chatName = &req.Name
 	}
 
-	chatID, err := s.chatService.CreateChat(ctx, chatName, memberIDs)
+	chatID, err := s.chatService.CreateChat(ctx, chatName, creatorID, memberIDs)
 	if err != nil {
+		if errors.Is(err, chat.ErrBlocked) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
 		return nil, status.Error(codes.Internal, "failed to create chat")
 	}
 
 	return &chatv1.CreateChatResponse{ChatId: chatID}, nil
 }
 
+func toProtoMessage(msg models.Message) *chatv1.Message {
+	return &chatv1.Message{
+		Id:       msg.ID,
+		ChatId:   msg.ChatID,
+		SenderId: msg.SenderID,
+		Text:     msg.Text,
+		SentAt:   timestamppb.New(msg.SentAt),
+		Pinned:   msg.Pinned,
+		Mentions: toProtoMentions(msg.Mentions),
+		Entities: convert.ToProtoEntities(msg.Entities),
+
+		LinkPreview:   toProtoLinkPreview(msg.LinkPreview),
+		ForwardedFrom: toProtoForwardedFrom(msg.ForwardedFrom),
+		ExpiresAt:     optionalTimestamp(msg.ExpiresAt),
+		Poll:          toProtoPoll(msg.Poll),
+	}
+}
+
+func toProtoPoll(p *models.Poll) *chatv1.Poll {
+	if p == nil {
+		return nil
+	}
+
+	options := make([]*chatv1.PollOption, 0, len(p.Options))
+	for _, o := range p.Options {
+		options = append(options, &chatv1.PollOption{
+			Text:   o.Text,
+			Votes:  int32(o.Votes),
+			Voters: o.Voters,
+			Chosen: o.Chosen,
+		})
+	}
+
+	return &chatv1.Poll{
+		Question:       p.Question,
+		Options:        options,
+		MultipleChoice: p.MultipleChoice,
+		Anonymous:      p.Anonymous,
+		ClosesAt:       optionalTimestamp(p.ClosesAt),
+		Closed:         p.Closed,
+		TotalVoters:    int32(p.TotalVoters),
+	}
+}
+
+func optionalTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func toProtoForwardedFrom(f *models.ForwardedFrom) *chatv1.ForwardedFrom {
+	if f == nil {
+		return nil
+	}
+	return &chatv1.ForwardedFrom{
+		ChatId:       f.ChatID,
+		MessageId:    f.MessageID,
+		SenderId:     f.SenderID,
+		SenderHidden: f.SenderHidden,
+		SentAt:       timestamppb.New(f.SentAt),
+	}
+}
+
+func toProtoLinkPreview(p *models.LinkPreview) *chatv1.LinkPreview {
+	if p == nil {
+		return nil
+	}
+	return &chatv1.LinkPreview{
+		Url:         p.URL,
+		Title:       p.Title,
+		Description: p.Description,
+		ImageUrl:    p.ImageURL,
+		SiteName:    p.SiteName,
+	}
+}
+
+func toProtoMentions(mentions []models.Mention) []*chatv1.Mention {
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	grpcMentions := make([]*chatv1.Mention, 0, len(mentions))
+	for _, m := range mentions {
+		grpcMentions = append(grpcMentions, &chatv1.Mention{
+			Offset: int32(m.Offset),
+			Length: int32(m.Length),
+			UserId: m.UserID,
+			All:    m.All,
+		})
+	}
+	return grpcMentions
+}
+
 func uniqueInt64(slice []int64) []int64 {
 	keys := make(map[int64]bool)
 	var list []int64
@@ -62,10 +163,19 @@ func (s *server) SendMessage(ctx context.Context, req *chatv1.SendMessageRequest
 		return nil, status.Error(codes.Internal, "failed to get user id from context")
 	}
 
-	msgID, sentAt, err := s.chatService.SendMessage(ctx, req.GetChatId(), senderID, req.GetText())
+	msgID, sentAt, err := s.chatService.SendMessage(ctx, req.GetChatId(), senderID, req.GetText(), convert.FromProtoEntities(req.GetEntities()), req.GetClientMessageId())
 	if err != nil {
-		if errors.Is(err, chat.ErrPermissionDenied) {
+		switch {
+		case errors.Is(err, chat.ErrPermissionDenied), errors.Is(err, chat.ErrBlocked):
 			return nil, status.Error(codes.PermissionDenied, err.Error())
+		case errors.Is(err, chat.ErrEmptyMessage),
+			errors.Is(err, chat.ErrMessageTooLong),
+			errors.Is(err, chat.ErrInvalidEntities),
+			errors.Is(err, chat.ErrMessageRejected),
+			errors.Is(err, chat.ErrInvalidClientMessageID):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, chat.ErrClientMessageIDReused):
+			return nil, status.Error(codes.AlreadyExists, err.Error())
 		}
 		return nil, status.Error(codes.Internal, "failed to send message")
 	}
@@ -93,15 +203,7 @@ func (s *server) GetChatHistory(req *chatv1.GetChatHistoryRequest, stream chatv1
 	}
 
 	for _, msg := range messages {
-		grpcMsg := &chatv1.Message{
-			Id:       msg.ID,
-			ChatId:   msg.ChatID,
-			SenderId: msg.SenderID,
-			Text:     msg.Text,
-			SentAt:   timestamppb.New(msg.SentAt),
-		}
-
-		if err := stream.Send(grpcMsg); err != nil {
+		if err := stream.Send(toProtoMessage(msg)); err != nil {
 			log.Printf("failed to send message to stream: %v", err)
 			return status.Error(codes.Internal, "failed to send message stream")
 		}
@@ -116,20 +218,515 @@ func (s *server) GetMyChats(ctx context.Context, req *chatv1.GetMyChatsRequest)
 		return nil, status.Error(codes.Internal, "failed to get user id from context")
 	}
 
-	chats, err := s.chatService.GetChatsByUserID(ctx, userID)
+	chats, nextPageToken, err := s.chatService.GetChatsByUserID(ctx, userID, req.GetIncludeArchived(), int(req.GetPageSize()), req.GetPageToken())
 	if err != nil {
+		if errors.Is(err, chat.ErrInvalidPageToken) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, status.Error(codes.Internal, "failed to get user chats")
 	}
 
 	grpcChats := make([]*chatv1.ChatInfo, 0, len(chats))
 	for _, chatInfo := range chats {
 		grpcChats = append(grpcChats, &chatv1.ChatInfo{
-			Id:   chatInfo.ID,
-			Name: chatInfo.Name,
+			Id:                chatInfo.ID,
+			Name:              chatInfo.Name,
+			UnreadMentions:    int32(chatInfo.UnreadMentions),
+			MessageTtlSeconds: int64(chatInfo.MessageTTL / time.Second),
+			Draft:             toProtoDraft(chatInfo.Draft),
+			Settings:          toProtoChatSettings(chatInfo.Settings),
+			LastMessage:       toProtoMessagePreview(chatInfo.LastMessage),
+			LastActivityAt:    timestamppb.New(chatInfo.LastActivityAt),
 		})
 	}
 
 	return &chatv1.GetMyChatsResponse{
-		Chats: grpcChats,
+		Chats:         grpcChats,
+		NextPageToken: nextPageToken,
+	}, nil
+}
+
+func toProtoMessagePreview(p *chatRepo.MessagePreview) *chatv1.MessagePreview {
+	if p == nil {
+		return nil
+	}
+	return &chatv1.MessagePreview{
+		Id:       p.ID,
+		SenderId: p.SenderID,
+		Snippet:  p.Snippet,
+		SentAt:   timestamppb.New(p.SentAt),
+	}
+}
+
+func (s *server) SearchMessages(ctx context.Context, req *chatv1.SearchMessagesRequest) (*chatv1.SearchMessagesResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	filter := chatRepo.SearchFilter{
+		Query: req.GetQuery(),
+		Limit: int(req.GetPageSize()),
+	}
+	if req.GetChatId() != "" {
+		filter.ChatID = &req.ChatId
+	}
+	if req.GetSenderId() != 0 {
+		filter.SenderID = &req.SenderId
+	}
+	if req.GetFrom() != nil {
+		from := req.GetFrom().AsTime()
+		filter.From = &from
+	}
+	if req.GetTo() != nil {
+		to := req.GetTo().AsTime()
+		filter.To = &to
+	}
+
+	results, nextPageToken, err := s.chatService.SearchMessages(ctx, userID, filter, req.GetPageToken())
+	if err != nil {
+		switch {
+		case errors.Is(err, chat.ErrPermissionDenied):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		case errors.Is(err, chat.ErrEmptySearchQuery),
+			errors.Is(err, chat.ErrInvalidPageToken),
+			errors.Is(err, chat.ErrInvalidSearchRange):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to search messages")
+	}
+
+	hits := make([]*chatv1.SearchHit, 0, len(results))
+	for _, res := range results {
+		highlights := make([]*chatv1.TextRange, 0, len(res.Highlights))
+		for _, h := range res.Highlights {
+			highlights = append(highlights, &chatv1.TextRange{
+				Offset: int32(h.Offset),
+				Length: int32(h.Length),
+			})
+		}
+
+		hits = append(hits, &chatv1.SearchHit{
+			Message:    toProtoMessage(res.Message),
+			Snippet:    res.Snippet,
+			Highlights: highlights,
+		})
+	}
+
+	return &chatv1.SearchMessagesResponse{
+		Results:       hits,
+		NextPageToken: nextPageToken,
 	}, nil
 }
+
+func (s *server) PinMessage(ctx context.Context, req *chatv1.PinMessageRequest) (*chatv1.PinMessageResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	pinnedAt, err := s.chatService.PinMessage(ctx, req.GetChatId(), req.GetMessageId(), userID)
+	if err != nil {
+		return nil, pinStatusError(err, "failed to pin message")
+	}
+
+	return &chatv1.PinMessageResponse{PinnedAt: timestamppb.New(pinnedAt)}, nil
+}
+
+func (s *server) UnpinMessage(ctx context.Context, req *chatv1.UnpinMessageRequest) (*chatv1.UnpinMessageResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	if err := s.chatService.UnpinMessage(ctx, req.GetChatId(), req.GetMessageId(), userID); err != nil {
+		return nil, pinStatusError(err, "failed to unpin message")
+	}
+
+	return &chatv1.UnpinMessageResponse{}, nil
+}
+
+func pinStatusError(err error, internalMsg string) error {
+	switch {
+	case errors.Is(err, chat.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, chat.ErrMessageNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Internal, internalMsg)
+}
+
+func (s *server) GetPinnedMessages(ctx context.Context, req *chatv1.GetPinnedMessagesRequest) (*chatv1.GetPinnedMessagesResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	pinned, err := s.chatService.GetPinnedMessages(ctx, req.GetChatId(), userID)
+	if err != nil {
+		if errors.Is(err, chat.ErrPermissionDenied) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to get pinned messages")
+	}
+
+	grpcPinned := make([]*chatv1.PinnedMessage, 0, len(pinned))
+	for _, pm := range pinned {
+		grpcPinned = append(grpcPinned, &chatv1.PinnedMessage{
+			Message:  toProtoMessage(pm.Message),
+			PinnedBy: pm.PinnedBy,
+			PinnedAt: timestamppb.New(pm.PinnedAt),
+		})
+	}
+
+	return &chatv1.GetPinnedMessagesResponse{Messages: grpcPinned}, nil
+}
+
+func (s *server) GetMentions(ctx context.Context, req *chatv1.GetMentionsRequest) (*chatv1.GetMentionsResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	mentioned, nextPageToken, err := s.chatService.GetMentions(ctx, userID, req.GetUnreadOnly(), int(req.GetPageSize()), req.GetPageToken())
+	if err != nil {
+		if errors.Is(err, chat.ErrInvalidPageToken) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to get mentions")
+	}
+
+	grpcMentioned := make([]*chatv1.MentionedMessage, 0, len(mentioned))
+	for _, mm := range mentioned {
+		grpcMentioned = append(grpcMentioned, &chatv1.MentionedMessage{
+			Message: toProtoMessage(mm.Message),
+			Read:    mm.Read,
+		})
+	}
+
+	return &chatv1.GetMentionsResponse{
+		Mentions:      grpcMentioned,
+		NextPageToken: nextPageToken,
+	}, nil
+}
+
+func (s *server) MarkMentionsRead(ctx context.Context, req *chatv1.MarkMentionsReadRequest) (*chatv1.MarkMentionsReadResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	if err := s.chatService.MarkMentionsRead(ctx, req.GetChatId(), userID); err != nil {
+		return nil, status.Error(codes.Internal, "failed to mark mentions read")
+	}
+
+	return &chatv1.MarkMentionsReadResponse{}, nil
+}
+
+func (s *server) ForwardMessages(ctx context.Context, req *chatv1.ForwardMessagesRequest) (*chatv1.ForwardMessagesResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	messages, err := s.chatService.ForwardMessages(ctx, req.GetFromChatId(), req.GetMessageIds(), req.GetToChatId(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, chat.ErrPermissionDenied), errors.Is(err, chat.ErrBlocked):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		case errors.Is(err, chat.ErrMessageNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, chat.ErrNothingToForward), errors.Is(err, chat.ErrTooManyToForward):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to forward messages")
+	}
+
+	grpcMessages := make([]*chatv1.Message, 0, len(messages))
+	for _, msg := range messages {
+		grpcMessages = append(grpcMessages, toProtoMessage(msg))
+	}
+
+	return &chatv1.ForwardMessagesResponse{Messages: grpcMessages}, nil
+}
+
+func toProtoScheduledMessage(msg chatRepo.ScheduledMessage) *chatv1.ScheduledMessage {
+	return &chatv1.ScheduledMessage{
+		Id:        msg.ID,
+		ChatId:    msg.ChatID,
+		Text:      msg.Text,
+		Entities:  convert.ToProtoEntities(msg.Entities),
+		SendAt:    timestamppb.New(msg.SendAt),
+		CreatedAt: timestamppb.New(msg.CreatedAt),
+	}
+}
+
+func scheduleStatusError(err error, internalMsg string) error {
+	switch {
+	case errors.Is(err, chat.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, chat.ErrScheduledMessageNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, chat.ErrTooManyScheduled):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, chat.ErrInvalidSendTime),
+		errors.Is(err, chat.ErrEmptyMessage),
+		errors.Is(err, chat.ErrMessageTooLong),
+		errors.Is(err, chat.ErrInvalidEntities):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, internalMsg)
+}
+
+func (s *server) ScheduleMessage(ctx context.Context, req *chatv1.ScheduleMessageRequest) (*chatv1.ScheduleMessageResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	scheduled, err := s.chatService.ScheduleMessage(ctx, req.GetChatId(), userID, req.GetText(), convert.FromProtoEntities(req.GetEntities()), req.GetSendAt().AsTime())
+	if err != nil {
+		return nil, scheduleStatusError(err, "failed to schedule message")
+	}
+
+	return &chatv1.ScheduleMessageResponse{ScheduledMessage: toProtoScheduledMessage(scheduled)}, nil
+}
+
+func (s *server) ListScheduledMessages(ctx context.Context, req *chatv1.ListScheduledMessagesRequest) (*chatv1.ListScheduledMessagesResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	var chatID *string
+	if req.GetChatId() != "" {
+		chatID = &req.ChatId
+	}
+
+	scheduled, err := s.chatService.ListScheduledMessages(ctx, userID, chatID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list scheduled messages")
+	}
+
+	grpcScheduled := make([]*chatv1.ScheduledMessage, 0, len(scheduled))
+	for _, msg := range scheduled {
+		grpcScheduled = append(grpcScheduled, toProtoScheduledMessage(msg))
+	}
+
+	return &chatv1.ListScheduledMessagesResponse{ScheduledMessages: grpcScheduled}, nil
+}
+
+func (s *server) UpdateScheduledMessage(ctx context.Context, req *chatv1.UpdateScheduledMessageRequest) (*chatv1.UpdateScheduledMessageResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	scheduled, err := s.chatService.UpdateScheduledMessage(ctx, req.GetId(), userID, req.GetText(), convert.FromProtoEntities(req.GetEntities()), req.GetSendAt().AsTime())
+	if err != nil {
+		return nil, scheduleStatusError(err, "failed to update scheduled message")
+	}
+
+	return &chatv1.UpdateScheduledMessageResponse{ScheduledMessage: toProtoScheduledMessage(scheduled)}, nil
+}
+
+func (s *server) CancelScheduledMessage(ctx context.Context, req *chatv1.CancelScheduledMessageRequest) (*chatv1.CancelScheduledMessageResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	if err := s.chatService.CancelScheduledMessage(ctx, req.GetId(), userID); err != nil {
+		return nil, scheduleStatusError(err, "failed to cancel scheduled message")
+	}
+
+	return &chatv1.CancelScheduledMessageResponse{}, nil
+}
+
+func (s *server) SetMessageTTL(ctx context.Context, req *chatv1.SetMessageTTLRequest) (*chatv1.SetMessageTTLResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	ttl := time.Duration(req.GetTtlSeconds()) * time.Second
+	if err := s.chatService.SetMessageTTL(ctx, req.GetChatId(), userID, ttl); err != nil {
+		switch {
+		case errors.Is(err, chat.ErrPermissionDenied):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		case errors.Is(err, chat.ErrInvalidMessageTTL):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to set message ttl")
+	}
+
+	return &chatv1.SetMessageTTLResponse{}, nil
+}
+
+func pollStatusError(err error, internalMsg string) error {
+	switch {
+	case errors.Is(err, chat.ErrPermissionDenied), errors.Is(err, chat.ErrBlocked):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, chat.ErrPollNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, chat.ErrPollClosed):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, chat.ErrInvalidPoll), errors.Is(err, chat.ErrInvalidVote):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, internalMsg)
+}
+
+func (s *server) CreatePoll(ctx context.Context, req *chatv1.CreatePollRequest) (*chatv1.CreatePollResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	poll := chatRepo.NewPoll{
+		Question:       req.GetQuestion(),
+		Options:        req.GetOptions(),
+		MultipleChoice: req.GetMultipleChoice(),
+		Anonymous:      req.GetAnonymous(),
+	}
+	if req.GetClosesAt() != nil {
+		closesAt := req.GetClosesAt().AsTime()
+		poll.ClosesAt = &closesAt
+	}
+
+	msg, err := s.chatService.CreatePoll(ctx, req.GetChatId(), userID, poll)
+	if err != nil {
+		return nil, pollStatusError(err, "failed to create poll")
+	}
+
+	return &chatv1.CreatePollResponse{Message: toProtoMessage(msg)}, nil
+}
+
+func (s *server) Vote(ctx context.Context, req *chatv1.VoteRequest) (*chatv1.VoteResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	options := make([]int, 0, len(req.GetOptionIds()))
+	for _, id := range req.GetOptionIds() {
+		options = append(options, int(id))
+	}
+
+	poll, err := s.chatService.Vote(ctx, req.GetChatId(), req.GetMessageId(), userID, options)
+	if err != nil {
+		return nil, pollStatusError(err, "failed to vote")
+	}
+
+	return &chatv1.VoteResponse{Poll: toProtoPoll(poll)}, nil
+}
+
+func (s *server) RetractVote(ctx context.Context, req *chatv1.RetractVoteRequest) (*chatv1.RetractVoteResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	poll, err := s.chatService.RetractVote(ctx, req.GetChatId(), req.GetMessageId(), userID)
+	if err != nil {
+		return nil, pollStatusError(err, "failed to retract vote")
+	}
+
+	return &chatv1.RetractVoteResponse{Poll: toProtoPoll(poll)}, nil
+}
+
+func toProtoDraft(d *models.Draft) *chatv1.Draft {
+	if d == nil {
+		return nil
+	}
+	return &chatv1.Draft{
+		ChatId:    d.ChatID,
+		Text:      d.Text,
+		Entities:  convert.ToProtoEntities(d.Entities),
+		UpdatedAt: timestamppb.New(d.UpdatedAt),
+	}
+}
+
+func (s *server) SaveDraft(ctx context.Context, req *chatv1.SaveDraftRequest) (*chatv1.SaveDraftResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	draft, err := s.chatService.SaveDraft(ctx, req.GetChatId(), userID, req.GetText(), convert.FromProtoEntities(req.GetEntities()), req.GetSessionId())
+	if err != nil {
+		switch {
+		case errors.Is(err, chat.ErrPermissionDenied):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		case errors.Is(err, chat.ErrMessageTooLong), errors.Is(err, chat.ErrInvalidEntities):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to save draft")
+	}
+
+	return &chatv1.SaveDraftResponse{Draft: toProtoDraft(&draft)}, nil
+}
+
+func (s *server) GetDrafts(ctx context.Context, req *chatv1.GetDraftsRequest) (*chatv1.GetDraftsResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	drafts, err := s.chatService.GetDrafts(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to get drafts")
+	}
+
+	grpcDrafts := make([]*chatv1.Draft, 0, len(drafts))
+	for i := range drafts {
+		grpcDrafts = append(grpcDrafts, toProtoDraft(&drafts[i]))
+	}
+
+	return &chatv1.GetDraftsResponse{Drafts: grpcDrafts}, nil
+}
+
+func toProtoChatSettings(settings models.ChatSettings) *chatv1.ChatSettings {
+	return &chatv1.ChatSettings{
+		MutedUntil: optionalTimestamp(settings.MutedUntil),
+		Archived:   settings.Archived,
+		Pinned:     settings.Pinned,
+		SortOrder:  int32(settings.SortOrder),
+	}
+}
+
+func (s *server) UpdateChatSettings(ctx context.Context, req *chatv1.UpdateChatSettingsRequest) (*chatv1.UpdateChatSettingsResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	update := chatRepo.ChatSettingsUpdate{
+		Unmute:   req.GetUnmute(),
+		Archived: req.Archived,
+		Pinned:   req.Pinned,
+	}
+	if req.GetMutedUntil() != nil {
+		mutedUntil := req.GetMutedUntil().AsTime()
+		update.MutedUntil = &mutedUntil
+	}
+	if req.SortOrder != nil {
+		sortOrder := int(req.GetSortOrder())
+		update.SortOrder = &sortOrder
+	}
+
+	settings, err := s.chatService.UpdateChatSettings(ctx, req.GetChatId(), userID, update)
+	if err != nil {
+		switch {
+		case errors.Is(err, chat.ErrPermissionDenied):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		case errors.Is(err, chat.ErrInvalidMuteTime):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, chat.ErrTooManyPinnedChats):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to update chat settings")
+	}
+
+	return &chatv1.UpdateChatSettingsResponse{Settings: toProtoChatSettings(settings)}, nil
+}
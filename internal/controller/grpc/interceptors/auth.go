@@ -19,6 +19,23 @@ const (
 	UserIDKey userCtxKey = "userID"
 )
 
+// SuspensionChecker tells whether a user is suspended. Suspended users are
+// rejected even when their token is still valid.
+type SuspensionChecker interface {
+	IsSuspended(ctx context.Context, userID int64) (bool, error)
+}
+
+func requireNotSuspended(ctx context.Context, suspensions SuspensionChecker, userID int64) error {
+	suspended, err := suspensions.IsSuspended(ctx, userID)
+	if err != nil {
+		return status.Error(codes.Internal, "failed to check account status")
+	}
+	if suspended {
+		return status.Error(codes.PermissionDenied, "account is suspended")
+	}
+	return nil
+}
+
 func authenticate(ctx context.Context, jwtSecret string) (int64, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
@@ -63,7 +80,7 @@ func authenticate(ctx context.Context, jwtSecret string) (int64, error) {
 	return userID, nil
 }
 
-func AuthUnaryInterceptor(jwtSecret string, publicMethods map[string]bool) grpc.UnaryServerInterceptor {
+func AuthUnaryInterceptor(jwtSecret string, publicMethods map[string]bool, suspensions SuspensionChecker) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		if _, ok := publicMethods[info.FullMethod]; ok {
 			return handler(ctx, req)
@@ -73,13 +90,16 @@ func AuthUnaryInterceptor(jwtSecret string, publicMethods map[string]bool) grpc.
 		if err != nil {
 			return nil, err
 		}
+		if err := requireNotSuspended(ctx, suspensions, userID); err != nil {
+			return nil, err
+		}
 
 		newCtx := context.WithValue(ctx, UserIDKey, userID)
 		return handler(newCtx, req)
 	}
 }
 
-func AuthStreamInterceptor(jwtSecret string, publicMethods map[string]bool) grpc.StreamServerInterceptor {
+func AuthStreamInterceptor(jwtSecret string, publicMethods map[string]bool, suspensions SuspensionChecker) grpc.StreamServerInterceptor {
 	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 		if _, ok := publicMethods[info.FullMethod]; ok {
 			return handler(srv, ss)
@@ -90,6 +110,9 @@ func AuthStreamInterceptor(jwtSecret string, publicMethods map[string]bool) grpc
 		if err != nil {
 			return err
 		}
+		if err := requireNotSuspended(ctx, suspensions, userID); err != nil {
+			return err
+		}
 
 		wrapped := newWrappedServerStream(ss, context.WithValue(ctx, UserIDKey, userID))
 		return handler(srv, wrapped)
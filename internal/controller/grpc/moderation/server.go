@@ -0,0 +1,255 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/controller/grpc/interceptors"
+	"github.com/christmas-fire/nexus/internal/models"
+	moderationRepo "github.com/christmas-fire/nexus/internal/repository/moderation"
+	"github.com/christmas-fire/nexus/internal/service/filter"
+	"github.com/christmas-fire/nexus/internal/service/moderation"
+	moderationv1 "github.com/christmas-fire/nexus/pkg/moderation/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type server struct {
+	moderationv1.UnimplementedModerationServiceServer
+	moderationService *moderation.ModerationService
+}
+
+func NewServer(moderationService *moderation.ModerationService) *server {
+	return &server{moderationService: moderationService}
+}
+
+var reportReasons = map[moderationv1.ReportReason]string{
+	moderationv1.ReportReason_REPORT_REASON_SPAM:           "spam",
+	moderationv1.ReportReason_REPORT_REASON_HARASSMENT:     "harassment",
+	moderationv1.ReportReason_REPORT_REASON_HATE_SPEECH:    "hate_speech",
+	moderationv1.ReportReason_REPORT_REASON_VIOLENCE:       "violence",
+	moderationv1.ReportReason_REPORT_REASON_SEXUAL_CONTENT: "sexual_content",
+	moderationv1.ReportReason_REPORT_REASON_OTHER:          "other",
+}
+
+var reportStatuses = map[moderationv1.ReportStatus]string{
+	moderationv1.ReportStatus_REPORT_STATUS_OPEN:      moderationRepo.ReportOpen,
+	moderationv1.ReportStatus_REPORT_STATUS_RESOLVED:  moderationRepo.ReportResolved,
+	moderationv1.ReportStatus_REPORT_STATUS_DISMISSED: moderationRepo.ReportDismissed,
+}
+
+var filterActions = map[moderationv1.FilterAction]string{
+	moderationv1.FilterAction_FILTER_ACTION_FLAG:   filter.Flag.String(),
+	moderationv1.FilterAction_FILTER_ACTION_MASK:   filter.Mask.String(),
+	moderationv1.FilterAction_FILTER_ACTION_REJECT: filter.Reject.String(),
+}
+
+func toProtoReport(r moderationRepo.Report) *moderationv1.Report {
+	report := &moderationv1.Report{
+		Id:             r.ID,
+		ReporterId:     r.ReporterID,
+		ReportedUserId: r.ReportedUserID,
+		Details:        r.Details,
+		ResolutionNote: r.ResolutionNote,
+		CreatedAt:      timestamppb.New(r.CreatedAt),
+	}
+	if r.ChatID != nil {
+		report.ChatId = *r.ChatID
+	}
+	if r.MessageID != nil {
+		report.MessageId = *r.MessageID
+	}
+	if r.MessageText != nil {
+		report.MessageText = *r.MessageText
+	}
+	if r.ResolvedBy != nil {
+		report.ResolvedBy = *r.ResolvedBy
+	}
+	if r.ResolvedAt != nil {
+		report.ResolvedAt = timestamppb.New(*r.ResolvedAt)
+	}
+	for reason, name := range reportReasons {
+		if name == r.Reason {
+			report.Reason = reason
+			break
+		}
+	}
+	for st, name := range reportStatuses {
+		if name == r.Status {
+			report.Status = st
+			break
+		}
+	}
+	return report
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func moderationStatusError(err error, internalMsg string) error {
+	switch {
+	case errors.Is(err, moderation.ErrNotModerator), errors.Is(err, moderation.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, moderation.ErrReportNotFound), errors.Is(err, moderation.ErrUserNotFound),
+		errors.Is(err, moderation.ErrMessageNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, moderation.ErrAlreadyReported):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, moderation.ErrReportClosed):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, moderation.ErrNothingToReport), errors.Is(err, moderation.ErrCannotReportSelf),
+		errors.Is(err, moderation.ErrCannotSuspendSelf), errors.Is(err, moderation.ErrInvalidReason),
+		errors.Is(err, moderation.ErrDetailsTooLong), errors.Is(err, moderation.ErrInvalidReportStatus),
+		errors.Is(err, moderation.ErrInvalidResolution), errors.Is(err, moderation.ErrInvalidSuspension),
+		errors.Is(err, moderation.ErrInvalidPageToken), errors.Is(err, moderation.ErrInvalidFilterAction):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, internalMsg)
+}
+
+func (s *server) Report(ctx context.Context, req *moderationv1.ReportRequest) (*moderationv1.ReportResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	report, err := s.moderationService.Report(ctx, userID, moderation.ReportInput{
+		ChatID:    req.GetChatId(),
+		MessageID: req.GetMessageId(),
+		UserID:    req.GetUserId(),
+		Reason:    reportReasons[req.GetReason()],
+		Details:   req.GetDetails(),
+	})
+	if err != nil {
+		return nil, moderationStatusError(err, "failed to file report")
+	}
+
+	return &moderationv1.ReportResponse{ReportId: report.ID}, nil
+}
+
+func (s *server) ListReports(ctx context.Context, req *moderationv1.ListReportsRequest) (*moderationv1.ListReportsResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	reports, nextPageToken, err := s.moderationService.ListReports(ctx, userID, reportStatuses[req.GetStatus()], int(req.GetPageSize()), req.GetPageToken())
+	if err != nil {
+		return nil, moderationStatusError(err, "failed to list reports")
+	}
+
+	grpcReports := make([]*moderationv1.Report, 0, len(reports))
+	for _, r := range reports {
+		grpcReports = append(grpcReports, toProtoReport(r))
+	}
+
+	return &moderationv1.ListReportsResponse{Reports: grpcReports, NextPageToken: nextPageToken}, nil
+}
+
+func (s *server) ResolveReport(ctx context.Context, req *moderationv1.ResolveReportRequest) (*moderationv1.ResolveReportResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	report, err := s.moderationService.ResolveReport(ctx, userID, req.GetReportId(), reportStatuses[req.GetStatus()], req.GetNote())
+	if err != nil {
+		return nil, moderationStatusError(err, "failed to resolve report")
+	}
+
+	return &moderationv1.ResolveReportResponse{Report: toProtoReport(report)}, nil
+}
+
+func (s *server) DeleteMessage(ctx context.Context, req *moderationv1.DeleteMessageRequest) (*moderationv1.DeleteMessageResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	err := s.moderationService.DeleteMessage(ctx, userID, req.GetChatId(), req.GetMessageId(), optionalString(req.GetReportId()))
+	if err != nil {
+		return nil, moderationStatusError(err, "failed to delete message")
+	}
+
+	return &moderationv1.DeleteMessageResponse{}, nil
+}
+
+func (s *server) SuspendUser(ctx context.Context, req *moderationv1.SuspendUserRequest) (*moderationv1.SuspendUserResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	var until *time.Time
+	if req.GetUntil() != nil {
+		t := req.GetUntil().AsTime()
+		until = &t
+	}
+
+	err := s.moderationService.SuspendUser(ctx, userID, req.GetUserId(), until, req.GetReason(), optionalString(req.GetReportId()))
+	if err != nil {
+		return nil, moderationStatusError(err, "failed to suspend user")
+	}
+
+	return &moderationv1.SuspendUserResponse{}, nil
+}
+
+func (s *server) UnsuspendUser(ctx context.Context, req *moderationv1.UnsuspendUserRequest) (*moderationv1.UnsuspendUserResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	if err := s.moderationService.UnsuspendUser(ctx, userID, req.GetUserId()); err != nil {
+		return nil, moderationStatusError(err, "failed to unsuspend user")
+	}
+
+	return &moderationv1.UnsuspendUserResponse{}, nil
+}
+
+func toProtoFilterDecision(d models.FilterDecision) *moderationv1.FilterDecision {
+	decision := &moderationv1.FilterDecision{
+		Id:        d.ID,
+		ChatId:    d.ChatID,
+		SenderId:  d.SenderID,
+		Filter:    d.Filter,
+		Reason:    d.Reason,
+		Text:      d.Text,
+		CreatedAt: timestamppb.New(d.CreatedAt),
+	}
+	if d.MessageID != nil {
+		decision.MessageId = *d.MessageID
+	}
+	for action, name := range filterActions {
+		if name == d.Action {
+			decision.Action = action
+			break
+		}
+	}
+	return decision
+}
+
+func (s *server) ListFilterDecisions(ctx context.Context, req *moderationv1.ListFilterDecisionsRequest) (*moderationv1.ListFilterDecisionsResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	decisions, nextPageToken, err := s.moderationService.ListFilterDecisions(ctx, userID, filterActions[req.GetAction()], int(req.GetPageSize()), req.GetPageToken())
+	if err != nil {
+		return nil, moderationStatusError(err, "failed to list filter decisions")
+	}
+
+	grpcDecisions := make([]*moderationv1.FilterDecision, 0, len(decisions))
+	for _, d := range decisions {
+		grpcDecisions = append(grpcDecisions, toProtoFilterDecision(d))
+	}
+
+	return &moderationv1.ListFilterDecisionsResponse{Decisions: grpcDecisions, NextPageToken: nextPageToken}, nil
+}
@@ -0,0 +1,149 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"github.com/christmas-fire/nexus/internal/controller/grpc/interceptors"
+	userRepo "github.com/christmas-fire/nexus/internal/repository/user"
+	"github.com/christmas-fire/nexus/internal/service/user"
+	userv1 "github.com/christmas-fire/nexus/pkg/user/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type server struct {
+	userv1.UnimplementedUserServiceServer
+	userService *user.UserService
+}
+
+func NewServer(userService *user.UserService) *server {
+	return &server{userService: userService}
+}
+
+func (s *server) GetPrivacySettings(ctx context.Context, req *userv1.GetPrivacySettingsRequest) (*userv1.GetPrivacySettingsResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	settings, err := s.userService.GetPrivacySettings(ctx, userID)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to get privacy settings")
+	}
+
+	return &userv1.GetPrivacySettingsResponse{Settings: toProtoPrivacySettings(settings)}, nil
+}
+
+func (s *server) UpdatePrivacySettings(ctx context.Context, req *userv1.UpdatePrivacySettingsRequest) (*userv1.UpdatePrivacySettingsResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	settings := userRepo.PrivacySettings{
+		HideForwardSender: req.GetSettings().GetHideForwardSender(),
+	}
+
+	if err := s.userService.UpdatePrivacySettings(ctx, userID, settings); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to update privacy settings")
+	}
+
+	return &userv1.UpdatePrivacySettingsResponse{Settings: toProtoPrivacySettings(settings)}, nil
+}
+
+func toProtoPrivacySettings(settings userRepo.PrivacySettings) *userv1.PrivacySettings {
+	return &userv1.PrivacySettings{
+		HideForwardSender: settings.HideForwardSender,
+	}
+}
+
+func (s *server) BlockUser(ctx context.Context, req *userv1.BlockUserRequest) (*userv1.BlockUserResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	if err := s.userService.BlockUser(ctx, userID, req.GetUserId()); err != nil {
+		switch {
+		case errors.Is(err, user.ErrUserNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, user.ErrCannotBlockSelf):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to block user")
+	}
+
+	return &userv1.BlockUserResponse{}, nil
+}
+
+func (s *server) UnblockUser(ctx context.Context, req *userv1.UnblockUserRequest) (*userv1.UnblockUserResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	if err := s.userService.UnblockUser(ctx, userID, req.GetUserId()); err != nil {
+		return nil, status.Error(codes.Internal, "failed to unblock user")
+	}
+
+	return &userv1.UnblockUserResponse{}, nil
+}
+
+func (s *server) ListBlocked(ctx context.Context, req *userv1.ListBlockedRequest) (*userv1.ListBlockedResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	blocked, err := s.userService.ListBlocked(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list blocked users")
+	}
+
+	grpcBlocked := make([]*userv1.BlockedUser, 0, len(blocked))
+	for _, b := range blocked {
+		grpcBlocked = append(grpcBlocked, &userv1.BlockedUser{
+			User:      toProtoUserSummary(b.UserSummary),
+			BlockedAt: timestamppb.New(b.BlockedAt),
+		})
+	}
+
+	return &userv1.ListBlockedResponse{Users: grpcBlocked}, nil
+}
+
+func (s *server) SearchUsers(ctx context.Context, req *userv1.SearchUsersRequest) (*userv1.SearchUsersResponse, error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return nil, status.Error(codes.Internal, "failed to get user id from context")
+	}
+
+	users, err := s.userService.SearchUsers(ctx, userID, req.GetQuery(), int(req.GetPageSize()))
+	if err != nil {
+		if errors.Is(err, user.ErrEmptySearchQuery) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to search users")
+	}
+
+	grpcUsers := make([]*userv1.UserSummary, 0, len(users))
+	for _, u := range users {
+		grpcUsers = append(grpcUsers, toProtoUserSummary(u))
+	}
+
+	return &userv1.SearchUsersResponse{Users: grpcUsers}, nil
+}
+
+func toProtoUserSummary(u userRepo.UserSummary) *userv1.UserSummary {
+	return &userv1.UserSummary{
+		Id:       u.ID,
+		Username: u.Username,
+	}
+}
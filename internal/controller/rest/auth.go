@@ -3,17 +3,21 @@ package rest
 import (
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/christmas-fire/nexus/internal/service/auth"
 )
 
 type AuthHandler struct {
 	service *auth.AuthService
+	tickets *auth.TicketStore
 }
 
-func NewAuthHandler(service *auth.AuthService) *AuthHandler {
-	return &AuthHandler{service: service}
+func NewAuthHandler(service *auth.AuthService, tickets *auth.TicketStore) *AuthHandler {
+	return &AuthHandler{service: service, tickets: tickets}
 }
 
 type RegisterRequest struct {
@@ -35,6 +39,11 @@ type LoginResponse struct {
 	AccessToken string `json:"access_token"`
 }
 
+type WSTicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -84,3 +93,33 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// WSTicket exchanges the bearer token of the request for a single-use
+// ticket to open a WebSocket with.
+func (h *AuthHandler) WSTicket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		http.Error(w, "Missing bearer token", http.StatusUnauthorized)
+		return
+	}
+	if _, err := h.service.ValidateToken(token); err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	ticket, expiresAt, err := h.tickets.Issue(r.Context(), token)
+	if err != nil {
+		log.Printf("failed to issue ws ticket: %v", err)
+		http.Error(w, "Could not issue ticket", http.StatusInternalServerError)
+		return
+	}
+
+	resp := WSTicketResponse{Ticket: ticket, ExpiresAt: expiresAt}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
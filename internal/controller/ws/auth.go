@@ -0,0 +1,155 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/service/auth"
+)
+
+const (
+	// authWait is how long a client that did not authenticate at upgrade
+	// has to send an "auth" message.
+	authWait = 10 * time.Second
+
+	// authSubprotocolPrefix marks a subprotocol carrying an access token,
+	// for clients that cannot set headers on the upgrade request. Such a
+	// client must offer one of the frame subprotocols too, since the server
+	// has to select a protocol other than the token.
+	authSubprotocolPrefix = "nexus.auth."
+)
+
+var (
+	errInvalidToken     = auth.ErrInvalidToken
+	errAccountSuspended = errors.New("account suspended")
+)
+
+// TokenValidator checks access tokens, returning the user a token was
+// issued to or auth.ErrInvalidToken.
+type TokenValidator interface {
+	ValidateToken(token string) (int64, error)
+}
+
+// upgradeToken returns the access token presented with the upgrade
+// request, taken from, in order, the Authorization header, a subprotocol
+// or a ticket in the query string. It returns an empty token if there is
+// none.
+func upgradeToken(r *http.Request, tickets *auth.TicketStore) (string, error) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token, nil
+	}
+	for _, protocol := range websocketProtocols(r) {
+		if token, ok := strings.CutPrefix(protocol, authSubprotocolPrefix); ok {
+			return token, nil
+		}
+	}
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		token, err := tickets.Redeem(r.Context(), ticket)
+		if errors.Is(err, auth.ErrInvalidTicket) {
+			return "", errInvalidToken
+		}
+		return token, err
+	}
+	return "", nil
+}
+
+func websocketProtocols(r *http.Request) []string {
+	var protocols []string
+	for _, header := range r.Header.Values("Sec-Websocket-Protocol") {
+		for _, p := range strings.Split(header, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				protocols = append(protocols, p)
+			}
+		}
+	}
+	return protocols
+}
+
+func rejectUpgrade(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidToken):
+		reject(w, rejectUnauthorized, "Invalid token", http.StatusUnauthorized)
+	case errors.Is(err, errAccountSuspended):
+		reject(w, rejectSuspended, "Account suspended", http.StatusForbidden)
+	default:
+		log.Printf("failed to authenticate websocket upgrade: %v", err)
+		reject(w, rejectAuthError, "Authentication failed", http.StatusInternalServerError)
+	}
+}
+
+// authenticate checks an access token and that its user may connect.
+func (h *Hub) authenticate(ctx context.Context, tokens TokenValidator, token string) (int64, error) {
+	userID, err := tokens.ValidateToken(token)
+	if err != nil {
+		return 0, err
+	}
+
+	suspended, err := h.moderationRepo.IsSuspended(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if suspended {
+		return 0, errAccountSuspended
+	}
+	return userID, nil
+}
+
+// join adds the authenticated client to the hub and answers req, or tells
+// a client authenticated at upgrade, with its auth status.
+// The latest sequence number is read before the client joins, so that
+// events published in between show up as a gap and are replayed.
+func (c *Client) join(req WsMessage) {
+	authResp := AuthResponse{Success: true, Message: "Authentication successful"}
+	var err error
+	if authResp.Seq, err = c.hub.journal.Latest(c.ctx, c.UserID); err != nil {
+		log.Printf("failed to get latest event of user %d: %v", c.UserID, err)
+	}
+	c.seqMu.Lock()
+	c.lastSeq = authResp.Seq
+	c.seqMu.Unlock()
+	c.reply(req, "auth_status", authResp)
+
+	c.hub.register <- c
+	log.Printf("client authenticated: UserID=%d", c.UserID)
+}
+
+// handleAuth serves the in-band "auth" message of clients that did not
+// authenticate at upgrade.
+func (c *Client) handleAuth(frame WsMessage, tokens TokenValidator) {
+	if c.UserID != 0 {
+		c.sendError(frame, errCodeFailedPrecondition, "already authenticated")
+		return
+	}
+
+	var authReq AuthRequest
+	if err := json.Unmarshal(frame.Payload, &authReq); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid auth payload")
+		return
+	}
+
+	userID, err := c.hub.authenticate(c.ctx, tokens, authReq.Token)
+	if err != nil {
+		authResp := AuthResponse{Success: false}
+		switch {
+		case errors.Is(err, errInvalidToken):
+			authResp.Message = "Invalid token"
+		case errors.Is(err, errAccountSuspended):
+			authResp.Message = "Account suspended"
+		default:
+			log.Printf("failed to authenticate user: %v", err)
+			authResp.Message = "Authentication failed"
+		}
+		c.reply(frame, "auth_status", authResp)
+		return
+	}
+
+	c.UserID = userID
+	c.Token = authReq.Token
+	c.Conn.SetReadDeadline(time.Time{})
+	c.join(frame)
+}
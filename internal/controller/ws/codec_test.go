@@ -0,0 +1,199 @@
+package ws
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/models"
+	wsv1 "github.com/christmas-fire/nexus/pkg/ws/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// framePayloads returns a payload for every frame type, with every field set
+// so that a field missing from ws.proto fails the round trip.
+func framePayloads() map[string]any {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC)
+	archived, sortOrder := true, int32(3)
+	big := int64(1) << 60
+
+	entities := []models.Entity{{Type: "link", Offset: 1, Length: 2, URL: "https://example.com", UserID: 3}}
+	poll := models.Poll{
+		Question:       "question",
+		Options:        []models.PollOption{{Text: "option", Votes: 1, Voters: []int64{big}, Chosen: true}},
+		MultipleChoice: true,
+		Anonymous:      true,
+		ClosesAt:       &now,
+		Closed:         true,
+		TotalVoters:    4,
+	}
+	msg := models.Message{
+		ID:              "message",
+		ChatID:          "chat",
+		SenderID:        big,
+		Text:            "hello",
+		SentAt:          now,
+		Pinned:          true,
+		Mentions:        []models.Mention{{Offset: 1, Length: 2, UserID: 5, All: true}},
+		Entities:        entities,
+		LinkPreview:     &models.LinkPreview{URL: "u", Title: "t", Description: "d", ImageURL: "i", SiteName: "s"},
+		ForwardedFrom:   &models.ForwardedFrom{ChatID: "c", MessageID: "m", SenderID: 1, SenderHidden: true, SentAt: now},
+		ExpiresAt:       &now,
+		Poll:            &poll,
+		ClientMessageID: "client",
+	}
+	draft := models.Draft{ChatID: "chat", Text: "draft", Entities: entities, UpdatedAt: now}
+	settings := models.ChatSettings{ChatID: "chat", MutedUntil: &now, Archived: true, Pinned: true, SortOrder: 2}
+	scheduled := ScheduledMessage{ID: "scheduled", ChatID: "chat", Text: "later", Entities: entities, SendAt: now, CreatedAt: now}
+
+	return map[string]any{
+		// Requests.
+		"auth":                     &AuthRequest{Token: "token"},
+		"resume":                   &ResumeRequest{LastSeq: big},
+		"send_message":             &SendMessageRequest{ChatID: "chat", Text: "hello", Entities: entities, ClientMessageID: "client"},
+		"get_my_chats":             &GetMyChatsRequest{IncludeArchived: true, PageSize: 2, PageToken: "page"},
+		"get_chat_history":         &GetChatHistoryRequest{ChatID: "chat"},
+		"search_messages":          &SearchMessagesRequest{Query: "q", ChatID: "chat", SenderID: big, From: &now, To: &now, PageSize: 3, PageToken: "page"},
+		"pin_message":              &PinMessageRequest{ChatID: "chat", MessageID: "message"},
+		"unpin_message":            &PinMessageRequest{ChatID: "chat", MessageID: "message"},
+		"get_pinned_messages":      &GetPinnedMessagesRequest{ChatID: "chat"},
+		"get_mentions":             &GetMentionsRequest{PageSize: 1, PageToken: "page", UnreadOnly: true},
+		"mark_mentions_read":       &MarkMentionsReadRequest{ChatID: "chat"},
+		"forward_messages":         &ForwardMessagesRequest{FromChatID: "from", MessageIDs: []string{"message"}, ToChatID: "to"},
+		"set_message_ttl":          &SetMessageTTLRequest{ChatID: "chat", TTLSeconds: big},
+		"create_poll":              &CreatePollRequest{ChatID: "chat", Question: "question", Options: []string{"a", "b"}, MultipleChoice: true, Anonymous: true, ClosesAt: &now},
+		"vote":                     &VoteRequest{ChatID: "chat", MessageID: "message", OptionIDs: []int32{1, 2}},
+		"retract_vote":             &VoteRequest{ChatID: "chat", MessageID: "message", OptionIDs: []int32{1}},
+		"save_draft":               &SaveDraftRequest{ChatID: "chat", Text: "draft", Entities: entities},
+		"get_drafts":               nil,
+		"update_chat_settings":     &UpdateChatSettingsRequest{ChatID: "chat", MutedUntil: &now, Unmute: true, Archived: &archived, Pinned: &archived, SortOrder: &sortOrder},
+		"schedule_message":         &ScheduleMessageRequest{ChatID: "chat", Text: "later", Entities: entities, SendAt: now},
+		"update_scheduled_message": &UpdateScheduledMessageRequest{ID: "scheduled", Text: "later", Entities: entities, SendAt: now},
+		"cancel_scheduled_message": &CancelScheduledMessageRequest{ID: "scheduled"},
+		"get_scheduled_messages":   &GetScheduledMessagesRequest{ChatID: "chat"},
+		"block_user":               &BlockUserRequest{UserID: big},
+		"unblock_user":             &BlockUserRequest{UserID: big},
+		"get_blocked_users":        nil,
+		"search_users":             &SearchUsersRequest{Query: "q", PageSize: 4},
+
+		// Replies.
+		"auth_status":     AuthResponse{Success: true, Message: "ok", Seq: big},
+		"error":           ErrorResponse{Code: "code", Message: "message"},
+		"resumed":         ResumedResponse{Seq: 3, Replayed: 2},
+		"resync_required": ResyncRequiredResponse{Seq: 3},
+		"message_sent":    MessageSentResponse{ChatID: "chat", MessageID: "message", SentAt: now, ClientMessageID: "client"},
+		"my_chats_list": MyChatsResponse{
+			Chats: []ChatInfo{{
+				ID:             "chat",
+				Name:           "name",
+				UnreadMentions: 2,
+				MessageTTL:     5,
+				Draft:          &draft,
+				Settings:       settings,
+				LastMessage:    &MessagePreview{ID: "message", SenderID: 1, Snippet: "snippet", SentAt: now},
+				LastActivityAt: now,
+			}},
+			NextPageToken: "page",
+		},
+		"chat_history":        ChatHistoryResponse{Messages: []models.Message{msg}},
+		"search_results":      SearchResultsResponse{Results: []SearchHit{{Message: msg, Snippet: "snippet", Highlights: []TextRange{{Offset: 1, Length: 2}}}}, NextPageToken: "page"},
+		"pinned_messages":     PinnedMessagesResponse{ChatID: "chat", Messages: []PinnedMessage{{Message: msg, PinnedBy: 1, PinnedAt: now}}},
+		"mentions_list":       MentionsResponse{Mentions: []MentionedMessage{{Message: msg, Read: true}}, NextPageToken: "page"},
+		"poll_vote_result":    models.PollUpdated{ChatID: "chat", MessageID: "message", Poll: poll},
+		"drafts_list":         DraftsResponse{Drafts: []models.Draft{draft}},
+		"scheduled_message":   scheduled,
+		"scheduled_messages":  ScheduledMessagesResponse{Messages: []ScheduledMessage{scheduled}},
+		"blocked_users":       BlockedUsersResponse{Users: []BlockedUser{{ID: 1, Username: "user", BlockedAt: now}}},
+		"user_search_results": SearchUsersResponse{Query: "q", Users: []UserSummary{{ID: 1, Username: "user"}}},
+		"ok":                  OkResponse{Request: "pin_message"},
+
+		// Events.
+		"new_message":           msg,
+		"mentioned":             msg,
+		"message_updated":       msg,
+		"message_pinned":        models.MessagePinned{ChatID: "chat", MessageID: "message", Pinned: true, ChangedBy: 1, ChangedAt: now},
+		"messages_expired":      models.MessagesExpired{ChatID: "chat", MessageIDs: []string{"a", "b"}},
+		"message_ttl_changed":   models.MessageTTLChanged{ChatID: "chat", TTLSeconds: 4, ChangedBy: 1, ChangedAt: now},
+		"draft_updated":         draft,
+		"chat_settings_updated": settings,
+		"poll_updated":          models.PollUpdated{ChatID: "chat", MessageID: "message", Poll: poll},
+		"message_deleted":       models.MessageDeleted{ChatID: "chat", MessageID: "message"},
+		"account_suspended":     models.AccountSuspended{Until: &now, Reason: "reason"},
+	}
+}
+
+// TestProtoCodecRoundTrip converts every frame type from JSON to protobuf
+// and back, and expects the payload to survive unchanged.
+func TestProtoCodecRoundTrip(t *testing.T) {
+	payloads := framePayloads()
+
+	fields := payloadOneof.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if _, ok := payloads[string(fields.Get(i).Name())]; !ok {
+			t.Errorf("no sample payload for %s frames", fields.Get(i).Name())
+		}
+	}
+
+	for typ, payload := range payloads {
+		frame, err := NewWsReply("request", typ, payload)
+		if err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		data, err := protoCodec{}.encode(frame)
+		if err != nil {
+			t.Errorf("%s: failed to encode: %v", typ, err)
+			continue
+		}
+
+		// Requests may leave the type to the payload field.
+		var f wsv1.Frame
+		if err := proto.Unmarshal(data, &f); err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		f.Type = ""
+		if data, err = proto.Marshal(&f); err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+
+		got, err := protoCodec{}.decode(data)
+		if err != nil {
+			t.Errorf("%s: failed to decode: %v", typ, err)
+			continue
+		}
+		if got.ID != "request" || got.Type != typ {
+			t.Errorf("%s: decoded as id %q type %q", typ, got.ID, got.Type)
+		}
+
+		want := json.RawMessage("{}")
+		if payload != nil {
+			var sent WsMessage
+			if err := json.Unmarshal(frame, &sent); err != nil {
+				t.Fatalf("%s: %v", typ, err)
+			}
+			want = sent.Payload
+		}
+		if !sameJSON(t, want, got.Payload) {
+			t.Errorf("%s: payload changed\nsent %s\n got %s", typ, want, got.Payload)
+		}
+	}
+}
+
+func TestProtoCodecRejectsUnknownFields(t *testing.T) {
+	frame := []byte(`{"type":"error","payload":{"code":"code","detail":"not in the schema"}}`)
+	if _, err := (protoCodec{}).encode(frame); err == nil {
+		t.Error("encoded a payload with a field missing from the schema")
+	}
+}
+
+func sameJSON(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var av, bv any
+	if err := json.Unmarshal(a, &av); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &bv); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(av, bv)
+}
@@ -0,0 +1,76 @@
+package ws
+
+import (
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error codes sent in "error" frames.
+const (
+	errCodeInvalidArgument    = "invalid_argument"
+	errCodeUnauthenticated    = "unauthenticated"
+	errCodePermissionDenied   = "permission_denied"
+	errCodeNotFound           = "not_found"
+	errCodeAlreadyExists      = "already_exists"
+	errCodeFailedPrecondition = "failed_precondition"
+	errCodeResourceExhausted  = "resource_exhausted"
+	errCodeUnavailable        = "unavailable"
+	errCodeInternal           = "internal"
+)
+
+var grpcErrorCodes = map[codes.Code]string{
+	codes.InvalidArgument:    errCodeInvalidArgument,
+	codes.OutOfRange:         errCodeInvalidArgument,
+	codes.Unauthenticated:    errCodeUnauthenticated,
+	codes.PermissionDenied:   errCodePermissionDenied,
+	codes.NotFound:           errCodeNotFound,
+	codes.AlreadyExists:      errCodeAlreadyExists,
+	codes.FailedPrecondition: errCodeFailedPrecondition,
+	codes.ResourceExhausted:  errCodeResourceExhausted,
+	codes.Unavailable:        errCodeUnavailable,
+	codes.DeadlineExceeded:   errCodeUnavailable,
+}
+
+// reply sends the response to a request, echoing its id.
+func (c *Client) reply(req WsMessage, typ string, payload interface{}) {
+	wsMsg, err := NewWsReply(req.ID, typ, payload)
+	if err != nil {
+		log.Printf("failed to create %s message: %v", typ, err)
+		return
+	}
+
+	c.send <- wsMsg
+}
+
+// ok acknowledges a request that succeeded and has no other reply.
+func (c *Client) ok(req WsMessage) {
+	c.reply(req, "ok", OkResponse{Request: req.Type})
+}
+
+func (c *Client) sendError(req WsMessage, code, message string) {
+	c.reply(req, "error", ErrorResponse{Code: code, Message: message})
+}
+
+// sendRPCError reports a failed gRPC call. Internal errors are not
+// described to the client beyond their code.
+func (c *Client) sendRPCError(req WsMessage, err error) {
+	st := status.Convert(err)
+	code, ok := grpcErrorCodes[st.Code()]
+	if !ok {
+		c.sendError(req, errCodeInternal, "internal error")
+		return
+	}
+	c.sendError(req, code, st.Message())
+}
+
+// requireAuth reports whether the client has authenticated, and answers
+// the request with an error frame if it has not.
+func (c *Client) requireAuth(req WsMessage) bool {
+	if c.UserID == 0 {
+		c.sendError(req, errCodeUnauthenticated, "not authenticated")
+		return false
+	}
+	return true
+}
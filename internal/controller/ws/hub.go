@@ -2,31 +2,46 @@ package ws
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"sync"
 
 	"github.com/christmas-fire/nexus/internal/models"
-	"github.com/christmas-fire/nexus/internal/repository/chat"
-	"github.com/redis/go-redis/v9"
+	"github.com/christmas-fire/nexus/internal/repository/moderation"
+	"github.com/christmas-fire/nexus/internal/service/events"
+	"github.com/gorilla/websocket"
 )
 
 type Hub struct {
-	clients    map[*Client]bool
+	clients map[*Client]bool
+	// byUser indexes authenticated clients by user; a user may be connected
+	// more than once.
+	byUser     map[int64]map[*Client]bool
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.RWMutex
-	redis      *redis.Client
-	chatRepo   chat.ChatRepository
+	bus        events.EventBus
+	// journal holds recent events per user for clients that resume.
+	journal *events.Journal
+	// moderationRepo is consulted at login so suspended users cannot
+	// open a session.
+	moderationRepo moderation.ModerationRepository
+
+	upgrader  websocket.Upgrader
+	readLimit int64
 }
 
-func NewHub(redisClient *redis.Client, chatRepo chat.ChatRepository) *Hub {
+func NewHub(bus events.EventBus, journal *events.Journal, moderationRepo moderation.ModerationRepository, opts Options) *Hub {
+	opts.setDefaults()
 	return &Hub{
-		clients:    make(map[*Client]bool),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		redis:      redisClient,
-		chatRepo:   chatRepo,
+		clients:        make(map[*Client]bool),
+		byUser:         make(map[int64]map[*Client]bool),
+		register:       make(chan *Client),
+		unregister:     make(chan *Client),
+		bus:            bus,
+		journal:        journal,
+		moderationRepo: moderationRepo,
+		upgrader:       newUpgrader(opts),
+		readLimit:      opts.ReadLimit,
 	}
 }
 
@@ -34,60 +49,132 @@ func (h *Hub) Run() {
 	for {
 		select {
 		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client] = true
-			h.mu.Unlock()
+			h.add(client)
 			log.Printf("client registered: %p", client.Conn)
 
 		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
+			if h.remove(client) {
 				log.Printf("client unregistered: %p", client.Conn)
 			}
-			h.mu.Unlock()
 		}
 	}
 }
 
-func (h *Hub) SubscribeToMessages(ctx context.Context) {
-	pubsub := h.redis.Subscribe(ctx, "messages")
-	defer pubsub.Close()
+// add registers an authenticated client and has the bus route its user's
+// events here. A client whose events cannot be routed here is disconnected,
+// so that it reconnects and resumes rather than going without live events.
+func (h *Hub) add(client *Client) {
+	h.mu.Lock()
+	h.clients[client] = true
+	sessions := h.byUser[client.UserID]
+	if sessions == nil {
+		sessions = make(map[*Client]bool)
+		h.byUser[client.UserID] = sessions
+	}
+	sessions[client] = true
+	h.mu.Unlock()
 
-	ch := pubsub.Channel()
+	client.watching = h.watch(client.UserID)
+	if !client.watching {
+		client.disconnect("events unavailable")
+	}
+}
 
-	for redisMsg := range ch {
-		var msg models.Message
-		if err := json.Unmarshal([]byte(redisMsg.Payload), &msg); err != nil {
-			log.Printf("failed to unmarshal message from redis: %v", err)
-			continue
-		}
+// remove reports whether the client was registered.
+func (h *Hub) remove(client *Client) bool {
+	h.mu.Lock()
+	if _, ok := h.clients[client]; !ok {
+		h.mu.Unlock()
+		return false
+	}
+	delete(h.clients, client)
+	wasIndexed := h.unindex(client)
+	h.mu.Unlock()
 
-		memberIDs, err := h.chatRepo.GetChatMemberIDs(ctx, msg.ChatID)
-		if err != nil {
-			log.Printf("failed to get chat members for broadcast: %v", err)
+	if wasIndexed && client.watching {
+		h.unwatch(client.UserID)
+	}
+	return true
+}
+
+// unindex must be called with mu held. It reports whether the client was
+// indexed.
+func (h *Hub) unindex(client *Client) bool {
+	sessions := h.byUser[client.UserID]
+	if !sessions[client] {
+		return false
+	}
+	delete(sessions, client)
+	if len(sessions) == 0 {
+		delete(h.byUser, client.UserID)
+	}
+	return true
+}
+
+// watch and unwatch are called outside mu since they may talk to Redis.
+// A session is unwatched only if watching it succeeded, so that a failure
+// does not cost another session of the user its watch. watch reports
+// whether the user's events are routed here.
+func (h *Hub) watch(userID int64) bool {
+	router, ok := h.bus.(events.Router)
+	if !ok {
+		return true
+	}
+	if err := router.Watch(context.Background(), userID); err != nil {
+		log.Printf("failed to route events of user %d to this hub: %v", userID, err)
+		return false
+	}
+	return true
+}
+
+func (h *Hub) unwatch(userID int64) {
+	router, ok := h.bus.(events.Router)
+	if !ok {
+		return
+	}
+	if err := router.Unwatch(context.Background(), userID); err != nil {
+		log.Printf("failed to stop routing events of user %d to this hub: %v", userID, err)
+	}
+}
+
+// SubscribeToMessages relays events from the bus to the connected clients
+// they are addressed to, until ctx is done. Every frame carries the
+// recipient's sequence number for the event, if it has one.
+func (h *Hub) SubscribeToMessages(ctx context.Context) {
+	if err := h.bus.Subscribe(ctx, h.dispatch); err != nil && ctx.Err() == nil {
+		log.Printf("event subscription ended: %v", err)
+	}
+}
+
+// dispatch costs time in proportion to the recipients connected to this
+// hub, however many other clients it has.
+func (h *Hub) dispatch(ctx context.Context, event models.Event) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, userID := range event.UserIDs {
+		sessions := h.byUser[userID]
+		if len(sessions) == 0 {
 			continue
 		}
 
-		wsMsgBytes, err := NewWsMessage("new_message", msg)
+		seq := event.Seqs[userID]
+		frame, err := NewSequencedWsMessage(seq, event.Type, event.Payload)
 		if err != nil {
 			log.Printf("failed to create ws message for broadcast: %v", err)
-			continue
+			return nil
 		}
 
-		h.mu.RLock()
-		for client := range h.clients {
-			for _, memberID := range memberIDs {
-				if client.UserID == memberID {
-					select {
-					case client.send <- wsMsgBytes:
-					default:
-						log.Printf("client send channel full, dropping message for user %d", client.UserID)
-					}
-					break
-				}
+		for client := range sessions {
+			if event.ExceptSession != "" && client.sessionID == event.ExceptSession {
+				client.deliver(seq, nil)
+				continue
+			}
+			client.deliver(seq, frame)
+			if event.Type == models.EventAccountSuspended {
+				client.disconnect("account suspended")
 			}
 		}
-		h.mu.RUnlock()
 	}
+	return nil
 }
@@ -0,0 +1,105 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/christmas-fire/nexus/internal/models"
+)
+
+const benchmarkClients = 100000
+
+// newBenchmarkHub returns a hub with benchmarkClients connected clients,
+// one per user, with user IDs 1 through benchmarkClients.
+func newBenchmarkHub(b *testing.B) *Hub {
+	b.Helper()
+
+	h := NewHub(nil, nil, nil, Options{})
+	for i := 1; i <= benchmarkClients; i++ {
+		client := &Client{
+			UserID:    int64(i),
+			hub:       h,
+			send:      make(chan []byte, 256),
+			kick:      make(chan string, 1),
+			sessionID: fmt.Sprintf("session-%d", i),
+		}
+		h.add(client)
+	}
+	return h
+}
+
+// BenchmarkHubDispatch measures delivering one event to audiences of
+// various sizes while benchmarkClients clients are connected. The cost
+// follows the audience rather than the number of connected clients.
+func BenchmarkHubDispatch(b *testing.B) {
+	h := newBenchmarkHub(b)
+	payload, err := json.Marshal(models.Message{ID: "message", ChatID: "chat", SenderID: 1, Text: "hello"})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, audience := range []int{2, 100, 10000} {
+		b.Run(fmt.Sprintf("audience=%d", audience), func(b *testing.B) {
+			event := models.Event{
+				Type:    "new_message",
+				ChatID:  "chat",
+				UserIDs: make([]int64, audience),
+				Seqs:    make(map[int64]int64, audience),
+				Payload: payload,
+			}
+			for i := range event.UserIDs {
+				// Spread the audience over the whole user range.
+				event.UserIDs[i] = int64(i*(benchmarkClients/audience) + 1)
+			}
+
+			ctx := context.Background()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				for _, userID := range event.UserIDs {
+					event.Seqs[userID] = int64(n + 1)
+				}
+				if err := h.dispatch(ctx, event); err != nil {
+					b.Fatal(err)
+				}
+
+				b.StopTimer()
+				drainAudience(h, event.UserIDs)
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// BenchmarkHubDispatchElsewhere measures an event whose audience is
+// connected to other instances only.
+func BenchmarkHubDispatchElsewhere(b *testing.B) {
+	h := newBenchmarkHub(b)
+	event := models.Event{
+		Type:    "new_message",
+		ChatID:  "chat",
+		UserIDs: []int64{benchmarkClients + 1, benchmarkClients + 2},
+		Payload: json.RawMessage(`{}`),
+	}
+
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := h.dispatch(ctx, event); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func drainAudience(h *Hub, userIDs []int64) {
+	for _, userID := range userIDs {
+		for client := range h.byUser[userID] {
+			for len(client.send) > 0 {
+				<-client.send
+			}
+		}
+	}
+}
@@ -7,8 +7,15 @@ import (
 	"github.com/christmas-fire/nexus/internal/models"
 )
 
+// WsMessage is the frame exchanged in both directions. A client may set ID
+// on a request; every reply to it, including an error frame, carries the
+// same ID. Broadcast events have no ID; instead they carry Seq, the user's
+// sequence number for the event, which a client presents in a resume
+// request after reconnecting.
 type WsMessage struct {
+	ID      string          `json:"id,omitempty"`
 	Type    string          `json:"type"`
+	Seq     int64           `json:"seq,omitempty"`
 	Payload json.RawMessage `json:"payload"`
 }
 
@@ -16,9 +23,30 @@ type AuthRequest struct {
 	Token string `json:"token"`
 }
 
+// AuthResponse carries, on success, the sequence number of the user's last
+// event, so that a new client knows where to resume from.
 type AuthResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
+	Seq     int64  `json:"seq,omitempty"`
+}
+
+// ResumeRequest asks for the events after LastSeq, the sequence number of
+// the last event the client saw.
+type ResumeRequest struct {
+	LastSeq int64 `json:"last_seq"`
+}
+
+// ResumedResponse follows the replayed events; Seq is the last of them.
+type ResumedResponse struct {
+	Seq      int64 `json:"seq"`
+	Replayed int   `json:"replayed"`
+}
+
+// ResyncRequiredResponse means the missed events are gone: the client has
+// to reload its chats and carry on from Seq.
+type ResyncRequiredResponse struct {
+	Seq int64 `json:"seq"`
 }
 
 type NewMessage struct {
@@ -30,17 +58,25 @@ type NewMessage struct {
 }
 
 type SendMessageRequest struct {
-	ChatID string `json:"chat_id"`
-	Text   string `json:"text"`
+	ChatID          string          `json:"chat_id"`
+	Text            string          `json:"text"`
+	Entities        []models.Entity `json:"entities,omitempty"`
+	ClientMessageID string          `json:"client_message_id,omitempty"`
 }
 
 func NewWsMessage(typ string, payload interface{}) ([]byte, error) {
+	return NewWsReply("", typ, payload)
+}
+
+// NewWsReply builds a reply to the request with the given id.
+func NewWsReply(id, typ string, payload interface{}) ([]byte, error) {
 	p, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
 	}
 
 	msg := WsMessage{
+		ID:      id,
 		Type:    typ,
 		Payload: p,
 	}
@@ -48,15 +84,61 @@ func NewWsMessage(typ string, payload interface{}) ([]byte, error) {
 	return json.Marshal(msg)
 }
 
-type GetMyChatsRequest struct{}
+// NewSequencedWsMessage builds the frame of an event with an already
+// encoded payload.
+func NewSequencedWsMessage(seq int64, typ string, payload json.RawMessage) ([]byte, error) {
+	return json.Marshal(WsMessage{Type: typ, Seq: seq, Payload: payload})
+}
+
+// ErrorResponse is the payload of an "error" frame.
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// OkResponse is the payload of an "ok" frame, which acknowledges a request
+// that has no other reply. Request is the type of that request.
+type OkResponse struct {
+	Request string `json:"request"`
+}
+
+// MessageSentResponse acknowledges a send_message request.
+type MessageSentResponse struct {
+	ChatID          string    `json:"chat_id"`
+	MessageID       string    `json:"message_id"`
+	SentAt          time.Time `json:"sent_at"`
+	ClientMessageID string    `json:"client_message_id,omitempty"`
+}
+
+type GetMyChatsRequest struct {
+	IncludeArchived bool   `json:"include_archived,omitempty"`
+	PageSize        int32  `json:"page_size,omitempty"`
+	PageToken       string `json:"page_token,omitempty"`
+}
 
 type MyChatsResponse struct {
-	Chats []ChatInfo `json:"chats"`
+	Chats         []ChatInfo `json:"chats"`
+	NextPageToken string     `json:"next_page_token,omitempty"`
 }
 
 type ChatInfo struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	UnreadMentions int32  `json:"unread_mentions"`
+	MessageTTL     int64  `json:"message_ttl_seconds,omitempty"`
+
+	Draft    *models.Draft       `json:"draft,omitempty"`
+	Settings models.ChatSettings `json:"settings"`
+
+	LastMessage    *MessagePreview `json:"last_message,omitempty"`
+	LastActivityAt time.Time       `json:"last_activity_at"`
+}
+
+type MessagePreview struct {
+	ID       string    `json:"id"`
+	SenderID int64     `json:"sender_id"`
+	Snippet  string    `json:"snippet"`
+	SentAt   time.Time `json:"sent_at"`
 }
 
 type GetChatHistoryRequest struct {
@@ -66,3 +148,181 @@ type GetChatHistoryRequest struct {
 type ChatHistoryResponse struct {
 	Messages []models.Message `json:"messages"`
 }
+
+type SearchMessagesRequest struct {
+	Query     string     `json:"query"`
+	ChatID    string     `json:"chat_id,omitempty"`
+	SenderID  int64      `json:"sender_id,omitempty"`
+	From      *time.Time `json:"from,omitempty"`
+	To        *time.Time `json:"to,omitempty"`
+	PageSize  int32      `json:"page_size,omitempty"`
+	PageToken string     `json:"page_token,omitempty"`
+}
+
+type TextRange struct {
+	Offset int32 `json:"offset"`
+	Length int32 `json:"length"`
+}
+
+type SearchHit struct {
+	Message    models.Message `json:"message"`
+	Snippet    string         `json:"snippet"`
+	Highlights []TextRange    `json:"highlights"`
+}
+
+type SearchResultsResponse struct {
+	Results       []SearchHit `json:"results"`
+	NextPageToken string      `json:"next_page_token,omitempty"`
+}
+
+type PinMessageRequest struct {
+	ChatID    string `json:"chat_id"`
+	MessageID string `json:"message_id"`
+}
+
+type GetPinnedMessagesRequest struct {
+	ChatID string `json:"chat_id"`
+}
+
+type PinnedMessage struct {
+	Message  models.Message `json:"message"`
+	PinnedBy int64          `json:"pinned_by"`
+	PinnedAt time.Time      `json:"pinned_at"`
+}
+
+type PinnedMessagesResponse struct {
+	ChatID   string          `json:"chat_id"`
+	Messages []PinnedMessage `json:"messages"`
+}
+
+type GetMentionsRequest struct {
+	PageSize   int32  `json:"page_size,omitempty"`
+	PageToken  string `json:"page_token,omitempty"`
+	UnreadOnly bool   `json:"unread_only,omitempty"`
+}
+
+type MentionedMessage struct {
+	Message models.Message `json:"message"`
+	Read    bool           `json:"read"`
+}
+
+type MentionsResponse struct {
+	Mentions      []MentionedMessage `json:"mentions"`
+	NextPageToken string             `json:"next_page_token,omitempty"`
+}
+
+type MarkMentionsReadRequest struct {
+	ChatID string `json:"chat_id"`
+}
+
+type ForwardMessagesRequest struct {
+	FromChatID string   `json:"from_chat_id"`
+	MessageIDs []string `json:"message_ids"`
+	ToChatID   string   `json:"to_chat_id"`
+}
+
+type SetMessageTTLRequest struct {
+	ChatID     string `json:"chat_id"`
+	TTLSeconds int64  `json:"ttl_seconds"`
+}
+
+type CreatePollRequest struct {
+	ChatID         string     `json:"chat_id"`
+	Question       string     `json:"question"`
+	Options        []string   `json:"options"`
+	MultipleChoice bool       `json:"multiple_choice,omitempty"`
+	Anonymous      bool       `json:"anonymous,omitempty"`
+	ClosesAt       *time.Time `json:"closes_at,omitempty"`
+}
+
+// VoteRequest is used by both vote and retract_vote; the latter ignores
+// OptionIDs.
+type VoteRequest struct {
+	ChatID    string  `json:"chat_id"`
+	MessageID string  `json:"message_id"`
+	OptionIDs []int32 `json:"option_ids,omitempty"`
+}
+
+type SaveDraftRequest struct {
+	ChatID   string          `json:"chat_id"`
+	Text     string          `json:"text"`
+	Entities []models.Entity `json:"entities,omitempty"`
+}
+
+type DraftsResponse struct {
+	Drafts []models.Draft `json:"drafts"`
+}
+
+// UpdateChatSettingsRequest changes only the fields that are present.
+type UpdateChatSettingsRequest struct {
+	ChatID     string     `json:"chat_id"`
+	MutedUntil *time.Time `json:"muted_until,omitempty"`
+	Unmute     bool       `json:"unmute,omitempty"`
+	Archived   *bool      `json:"archived,omitempty"`
+	Pinned     *bool      `json:"pinned,omitempty"`
+	SortOrder  *int32     `json:"sort_order,omitempty"`
+}
+
+type ScheduleMessageRequest struct {
+	ChatID   string          `json:"chat_id"`
+	Text     string          `json:"text"`
+	Entities []models.Entity `json:"entities,omitempty"`
+	SendAt   time.Time       `json:"send_at"`
+}
+
+type UpdateScheduledMessageRequest struct {
+	ID       string          `json:"id"`
+	Text     string          `json:"text"`
+	Entities []models.Entity `json:"entities,omitempty"`
+	SendAt   time.Time       `json:"send_at"`
+}
+
+type CancelScheduledMessageRequest struct {
+	ID string `json:"id"`
+}
+
+type GetScheduledMessagesRequest struct {
+	ChatID string `json:"chat_id,omitempty"`
+}
+
+type ScheduledMessage struct {
+	ID        string          `json:"id"`
+	ChatID    string          `json:"chat_id"`
+	Text      string          `json:"text"`
+	Entities  []models.Entity `json:"entities,omitempty"`
+	SendAt    time.Time       `json:"send_at"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type ScheduledMessagesResponse struct {
+	Messages []ScheduledMessage `json:"messages"`
+}
+
+type BlockUserRequest struct {
+	UserID int64 `json:"user_id"`
+}
+
+type BlockedUser struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+type BlockedUsersResponse struct {
+	Users []BlockedUser `json:"users"`
+}
+
+type SearchUsersRequest struct {
+	Query    string `json:"query"`
+	PageSize int32  `json:"page_size,omitempty"`
+}
+
+type UserSummary struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type SearchUsersResponse struct {
+	Query string        `json:"query"`
+	Users []UserSummary `json:"users"`
+}
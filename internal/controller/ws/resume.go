@@ -0,0 +1,166 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/christmas-fire/nexus/internal/service/events"
+)
+
+// maxResumeEvents is the most events replayed to a resuming client; a
+// client further behind has to resync.
+const maxResumeEvents = 1000
+
+type heldEvent struct {
+	seq   int64
+	frame []byte
+}
+
+// deliver queues an event frame for the client. A nil frame is not sent
+// but still counts as delivered, for events the client already knows
+// about. Events the client has already been sent, which happens around a
+// resume, are skipped.
+func (c *Client) deliver(seq int64, frame []byte) {
+	c.seqMu.Lock()
+	defer c.seqMu.Unlock()
+
+	if c.replaying {
+		c.held = append(c.held, heldEvent{seq: seq, frame: frame})
+		return
+	}
+	c.queueEvent(seq, frame)
+}
+
+// queueEvent must be called with seqMu held. Events are numbered before
+// they are published, so concurrent publishes can reach the hub out of
+// order: an event that skips ahead of lastSeq is held back while the
+// missing ones are read from the journal, where they already are.
+//
+// A client that does not keep up is disconnected rather than silently
+// missing events: it can resume from the last one it got after
+// reconnecting.
+func (c *Client) queueEvent(seq int64, frame []byte) {
+	if seq != 0 {
+		switch {
+		case c.lastSeq != 0 && seq <= c.lastSeq:
+			return
+		case c.lastSeq != 0 && seq > c.lastSeq+1:
+			c.replaying = true
+			c.held = append(c.held, heldEvent{seq: seq, frame: frame})
+			go c.catchUp()
+			return
+		}
+		c.lastSeq = seq
+	}
+	if frame == nil {
+		return
+	}
+
+	select {
+	case c.send <- frame:
+	default:
+		log.Printf("client send channel full, disconnecting user %d", c.UserID)
+		c.disconnect("too slow")
+	}
+}
+
+// handleResume replays the events after the client's last seen one, then
+// answers "resumed", or "resync_required" if they are no longer available.
+// Live events that arrive in the meantime follow the replayed ones.
+func (c *Client) handleResume(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req ResumeRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid resume payload")
+		return
+	}
+
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+
+	c.seqMu.Lock()
+	c.replaying = true
+	c.seqMu.Unlock()
+
+	latest, replayed, err := c.replay(req.LastSeq)
+	switch {
+	case errors.Is(err, events.ErrResyncRequired):
+		c.reply(frame, "resync_required", ResyncRequiredResponse{Seq: latest})
+	case err != nil:
+		c.sendError(frame, errCodeUnavailable, "failed to resume")
+	default:
+		c.reply(frame, "resumed", ResumedResponse{Seq: latest, Replayed: replayed})
+	}
+	c.endReplay(latest, err)
+}
+
+// catchUp fills a gap in the live events from the journal. The client is
+// told to resync if the missing events are gone, and disconnected if the
+// journal cannot be read, so that it resumes later.
+func (c *Client) catchUp() {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+
+	c.seqMu.Lock()
+	after := c.lastSeq
+	c.replaying = true
+	c.seqMu.Unlock()
+
+	latest, _, err := c.replay(after)
+	switch {
+	case errors.Is(err, events.ErrResyncRequired):
+		c.reply(WsMessage{}, "resync_required", ResyncRequiredResponse{Seq: latest})
+	case err != nil:
+		c.disconnect("missed events")
+	}
+	c.endReplay(latest, err)
+}
+
+// replay sends the journaled events after seq. It returns the latest
+// sequence number of the user and how many events were sent. Frames are
+// sent without seqMu held, so that a long replay does not hold up the hub.
+func (c *Client) replay(after int64) (int64, int, error) {
+	entries, latest, err := c.hub.journal.Since(c.ctx, c.UserID, after, maxResumeEvents)
+	if err != nil && !errors.Is(err, events.ErrResyncRequired) {
+		log.Printf("failed to read journal of user %d: %v", c.UserID, err)
+	}
+
+	for _, entry := range entries {
+		wsMsg, err := NewSequencedWsMessage(entry.Seq, entry.Type, entry.Payload)
+		if err != nil {
+			log.Printf("failed to create ws message for replay: %v", err)
+			continue
+		}
+		select {
+		case c.send <- wsMsg:
+		case <-c.ctx.Done():
+			return latest, 0, c.ctx.Err()
+		}
+	}
+	return latest, len(entries), err
+}
+
+// endReplay queues the live events held back during a replay. Should they
+// still leave a gap, another replay follows.
+func (c *Client) endReplay(latest int64, err error) {
+	c.seqMu.Lock()
+	defer c.seqMu.Unlock()
+
+	if err == nil || errors.Is(err, events.ErrResyncRequired) {
+		c.lastSeq = latest
+	}
+	held := c.held
+	c.held = nil
+	c.replaying = false
+	for i, ev := range held {
+		if c.replaying {
+			c.held = append(c.held, held[i:]...)
+			return
+		}
+		c.queueEvent(ev.seq, ev.frame)
+	}
+}
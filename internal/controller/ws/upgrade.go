@@ -0,0 +1,102 @@
+package ws
+
+import (
+	"errors"
+	"expvar"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// Reasons a connection is refused or cut off, as counted in rejections.
+const (
+	rejectOrigin       = "origin"
+	rejectUnauthorized = "unauthorized"
+	rejectSuspended    = "suspended"
+	rejectAuthError    = "auth_error"
+	rejectHandshake    = "handshake"
+	rejectAuthTimeout  = "auth_timeout"
+	rejectReadLimit    = "read_limit"
+)
+
+// rejections counts refused and cut off connections by reason. It is
+// published with expvar as ws_rejections, on the admin listener.
+var rejections = expvar.NewMap("ws_rejections")
+
+type Options struct {
+	// AllowedOrigins lists the origins, as scheme://host[:port], that
+	// browsers may open a socket from. "*" allows any origin. Without
+	// any, only pages served from the gateway's own host may connect.
+	// Requests without an Origin header do not come from browsers and are
+	// not checked.
+	AllowedOrigins []string
+	// EnableCompression negotiates per-message compression with clients
+	// that offer it.
+	EnableCompression bool
+	// ReadLimit is the size in bytes of the largest message a client may
+	// send; the connection is closed if it sends a larger one.
+	ReadLimit int64
+}
+
+func (o *Options) setDefaults() {
+	if o.ReadLimit <= 0 {
+		o.ReadLimit = 64 << 10
+	}
+}
+
+// newUpgrader returns the upgrader for opts.
+func newUpgrader(opts Options) websocket.Upgrader {
+	allowed := make(map[string]bool, len(opts.AllowedOrigins))
+	for _, origin := range opts.AllowedOrigins {
+		allowed[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+
+	return websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return originAllowed(r, allowed)
+		},
+		EnableCompression: opts.EnableCompression,
+		Subprotocols:      []string{subprotocolJSON, subprotocolProto},
+	}
+}
+
+func originAllowed(r *http.Request, allowed map[string]bool) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if allowed["*"] {
+		return true
+	}
+	if len(allowed) > 0 {
+		return allowed[strings.ToLower(origin)]
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// reject counts a refused connection and answers the request.
+func reject(w http.ResponseWriter, reason, message string, status int) {
+	rejections.Add(reason, 1)
+	http.Error(w, message, status)
+}
+
+// readRejection tells which rejection, if any, ended a connection whose
+// read failed with err.
+func (c *Client) readRejection(err error) (string, bool) {
+	if errors.Is(err, websocket.ErrReadLimit) {
+		return rejectReadLimit, true
+	}
+	var netErr net.Error
+	if c.UserID == 0 && errors.As(err, &netErr) && netErr.Timeout() {
+		return rejectAuthTimeout, true
+	}
+	return "", false
+}
@@ -2,57 +2,106 @@ package ws
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"log"
 	"net/http"
-	"strconv"
+	"sync"
 	"time"
 
+	"github.com/christmas-fire/nexus/internal/controller/convert"
 	"github.com/christmas-fire/nexus/internal/models"
+	"github.com/christmas-fire/nexus/internal/service/auth"
 	chatv1 "github.com/christmas-fire/nexus/pkg/chat/v1"
-	"github.com/golang-jwt/jwt/v5"
+	userv1 "github.com/christmas-fire/nexus/pkg/user/v1"
 	"github.com/gorilla/websocket"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
-}
-
 const (
-	writeWait      = 10 * time.Second
-	maxMessageSize = 512
-	pingPeriod     = (pongWait * 9) / 10
-	pongWait       = 60 * time.Second
+	writeWait  = 10 * time.Second
+	pingPeriod = (pongWait * 9) / 10
+	pongWait   = 60 * time.Second
 )
 
 type Client struct {
 	UserID     int64
 	Token      string
 	Conn       *websocket.Conn
+	codec      codec
 	hub        *Hub
 	send       chan []byte
 	chatClient chatv1.ChatServiceClient
+	userClient userv1.UserServiceClient
 	ctx        context.Context
+	// sessionID tells this connection apart from the user's other sessions.
+	sessionID string
+	// kick carries the reason when the server ends the session.
+	kick chan string
+	// watching is set by the hub once the bus routes the user's events to
+	// it for this session.
+	watching bool
+
+	// replayMu serializes replays from the journal.
+	replayMu sync.Mutex
+	// seqMu guards the event delivery state below.
+	seqMu sync.Mutex
+	// lastSeq is the sequence number of the last event queued for the
+	// client; every event before it has been queued too. Zero until known.
+	lastSeq int64
+	// replaying is set while events are replayed from the journal; live
+	// events are held back meanwhile and queued after the replayed ones.
+	replaying bool
+	held      []heldEvent
 }
 
-func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, jwtSecret string, chatClient chatv1.ChatServiceClient) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+// ServeWs authenticates the request and upgrades it. A client that
+// presents no credentials at upgrade has authWait to send an "auth"
+// message; it only joins the hub once authenticated.
+func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, tokens TokenValidator, tickets *auth.TicketStore, chatClient chatv1.ChatServiceClient, userClient userv1.UserServiceClient) {
+	// Checked before anything else so that a foreign page cannot even
+	// redeem a ticket.
+	if !hub.upgrader.CheckOrigin(r) {
+		reject(w, rejectOrigin, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	token, err := upgradeToken(r, tickets)
+	var userID int64
+	if err == nil && token != "" {
+		userID, err = hub.authenticate(r.Context(), tokens, token)
+	}
 	if err != nil {
+		rejectUpgrade(w, err)
+		return
+	}
+
+	conn, err := hub.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		rejections.Add(rejectHandshake, 1)
 		log.Printf("failed to upgrade connection: %v", err)
 		return
 	}
+	conn.SetReadLimit(hub.readLimit)
 
 	client := &Client{
+		UserID:     userID,
+		Token:      token,
 		Conn:       conn,
+		codec:      newCodec(conn.Subprotocol()),
 		hub:        hub,
 		send:       make(chan []byte, 256),
+		kick:       make(chan string, 1),
 		chatClient: chatClient,
-		ctx:        r.Context()}
-	client.hub.register <- client
+		userClient: userClient,
+		ctx:        r.Context(),
+		sessionID:  newSessionID(),
+	}
 
-	log.Printf("client connected: %p", client.Conn)
+	log.Printf("client connected: %p (%s)", client.Conn, conn.Subprotocol())
 
 	defer func() {
 		client.hub.unregister <- client
@@ -60,7 +109,20 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, jwtSecret string,
 	}()
 
 	go client.writePump()
-	client.readPump(jwtSecret)
+	if userID != 0 {
+		client.join(WsMessage{})
+	} else {
+		client.Conn.SetReadDeadline(time.Now().Add(authWait))
+	}
+	client.readPump(tokens)
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("failed to generate session id: %v", err)
+	}
+	return hex.EncodeToString(b)
 }
 
 func (c *Client) writePump() {
@@ -78,116 +140,200 @@ func (c *Client) writePump() {
 				return
 			}
 
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
+			if err := c.write(message); err != nil {
 				return
 			}
-			w.Write(message)
+		case reason := <-c.kick:
+			c.flushAndClose(reason)
+			return
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
 
-			if err := w.Close(); err != nil {
+// write sends a frame in the client's encoding. A frame that cannot be
+// encoded closes the connection instead of being skipped, so the client
+// reconnects and resumes rather than silently missing an event.
+func (c *Client) write(frame []byte) error {
+	data, err := c.codec.encode(frame)
+	if err != nil {
+		log.Printf("failed to encode frame for client %p: %v", c.Conn, err)
+		c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "frame could not be encoded"))
+		return err
+	}
+	return c.Conn.WriteMessage(c.codec.messageType(), data)
+}
+
+// disconnect asks writePump to end the session once the messages already
+// queued for the client have been written.
+func (c *Client) disconnect(reason string) {
+	select {
+	case c.kick <- reason:
+	default:
+	}
+}
+
+func (c *Client) flushAndClose(reason string) {
+	for {
+		select {
+		case message, ok := <-c.send:
+			if !ok {
 				return
 			}
-		case <-ticker.C:
 			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err := c.write(message); err != nil {
 				return
 			}
+		default:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason))
+			return
 		}
 	}
 }
 
-func (c *Client) readPump(jwtSecret string) {
+func (c *Client) readPump(tokens TokenValidator) {
 	for {
 		_, message, err := c.Conn.ReadMessage()
 		if err != nil {
+			if reason, ok := c.readRejection(err); ok {
+				rejections.Add(reason, 1)
+				log.Printf("closing connection %p: %s", c.Conn, reason)
+				break
+			}
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("unexpected websocket close error: %v", err)
 			}
 			break
 		}
 
-		var msg WsMessage
-		if err := json.Unmarshal(message, &msg); err != nil {
-			log.Printf("failed to unmarshal message: %v", err)
+		msg, err := c.codec.decode(message)
+		if err != nil {
+			c.sendError(WsMessage{}, errCodeInvalidArgument, "malformed message")
 			continue
 		}
 
 		switch msg.Type {
 		case "auth":
-			c.handleAuth(msg.Payload, jwtSecret)
+			c.handleAuth(msg, tokens)
+
+		case "resume":
+			c.handleResume(msg)
 
 		case "send_message":
-			c.handleSendMessage(msg.Payload)
+			c.handleSendMessage(msg)
 
 		case "get_my_chats":
-			c.handleGetMyChats()
+			c.handleGetMyChats(msg)
 
 		case "get_chat_history":
-			c.handleGetChatHistory(msg.Payload)
-		}
+			c.handleGetChatHistory(msg)
 
-	}
-}
+		case "search_messages":
+			c.handleSearchMessages(msg)
 
-func (c *Client) handleAuth(payload []byte, jwtSecret string) {
-	var authReq AuthRequest
-	if err := json.Unmarshal(payload, &authReq); err != nil {
-		log.Printf("failed to unmarshal auth payload: %v", err)
-		return
-	}
+		case "pin_message":
+			c.handlePinMessage(msg, true)
 
-	token, err := jwt.Parse(authReq.Token, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return []byte(jwtSecret), nil
-	})
+		case "unpin_message":
+			c.handlePinMessage(msg, false)
+
+		case "get_pinned_messages":
+			c.handleGetPinnedMessages(msg)
 
-	authResp := AuthResponse{Success: false}
-	if err != nil || !token.Valid {
-		authResp.Message = "Invalid token"
-	} else if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		if userIDStr, ok := claims["sub"].(string); ok {
-			userID, _ := strconv.ParseInt(userIDStr, 10, 64)
-			c.UserID = userID
-			c.Token = authReq.Token
-			authResp.Success = true
-			authResp.Message = "Authentication successful"
-			log.Printf("client authenticated: UserID=%d", c.UserID)
-		} else {
-			authResp.Message = "Invalid token claims"
+		case "get_mentions":
+			c.handleGetMentions(msg)
+
+		case "mark_mentions_read":
+			c.handleMarkMentionsRead(msg)
+
+		case "forward_messages":
+			c.handleForwardMessages(msg)
+
+		case "set_message_ttl":
+			c.handleSetMessageTTL(msg)
+
+		case "create_poll":
+			c.handleCreatePoll(msg)
+
+		case "vote":
+			c.handleVote(msg, true)
+
+		case "retract_vote":
+			c.handleVote(msg, false)
+
+		case "save_draft":
+			c.handleSaveDraft(msg)
+
+		case "get_drafts":
+			c.handleGetDrafts(msg)
+
+		case "update_chat_settings":
+			c.handleUpdateChatSettings(msg)
+
+		case "schedule_message":
+			c.handleScheduleMessage(msg)
+
+		case "update_scheduled_message":
+			c.handleUpdateScheduledMessage(msg)
+
+		case "cancel_scheduled_message":
+			c.handleCancelScheduledMessage(msg)
+
+		case "get_scheduled_messages":
+			c.handleGetScheduledMessages(msg)
+
+		case "block_user":
+			c.handleBlockUser(msg, true)
+
+		case "unblock_user":
+			c.handleBlockUser(msg, false)
+
+		case "get_blocked_users":
+			c.handleGetBlockedUsers(msg)
+
+		case "search_users":
+			c.handleSearchUsers(msg)
+
+		default:
+			c.sendError(msg, errCodeInvalidArgument, "unknown message type: "+msg.Type)
 		}
-	} else {
-		authResp.Message = "Invalid token claims"
-	}
 
-	respBytes, err := NewWsMessage("auth_status", authResp)
-	if err != nil {
-		log.Printf("failed to create auth response message: %v", err)
-		return
 	}
-
-	c.Conn.WriteMessage(websocket.TextMessage, respBytes)
 }
 
-func (c *Client) handleSendMessage(payload json.RawMessage) {
-	if c.Token == "" { /* ... */
+func (c *Client) handleSendMessage(frame WsMessage) {
+	if !c.requireAuth(frame) {
 		return
 	}
 	var req SendMessageRequest
-	if err := json.Unmarshal(payload, &req); err != nil { /* ... */
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid send_message payload")
 		return
 	}
 
-	_, err := c.chatClient.SendMessage(c.createAuthContext(), &chatv1.SendMessageRequest{
-		ChatId: req.ChatID,
-		Text:   req.Text,
+	grpcResp, err := c.chatClient.SendMessage(c.createAuthContext(), &chatv1.SendMessageRequest{
+		ChatId:          req.ChatID,
+		Text:            req.Text,
+		Entities:        convert.ToProtoEntities(req.Entities),
+		ClientMessageId: req.ClientMessageID,
 	})
-
 	if err != nil {
 		log.Printf("failed to send message via gRPC: %v", err)
+		c.sendRPCError(frame, err)
+		return
 	}
 
+	c.reply(frame, "message_sent", MessageSentResponse{
+		ChatID:          req.ChatID,
+		MessageID:       grpcResp.GetMessageId(),
+		SentAt:          grpcResp.GetSentAt().AsTime(),
+		ClientMessageID: req.ClientMessageID,
+	})
 }
 
 func (c *Client) createAuthContext() context.Context {
@@ -195,52 +341,67 @@ func (c *Client) createAuthContext() context.Context {
 	return metadata.NewOutgoingContext(c.ctx, md)
 }
 
-func (c *Client) handleGetMyChats() {
-	if c.UserID == 0 {
+func (c *Client) handleGetMyChats(frame WsMessage) {
+	if !c.requireAuth(frame) {
 		return
 	}
 
-	grpcResp, err := c.chatClient.GetMyChats(c.createAuthContext(), &chatv1.GetMyChatsRequest{})
+	var req GetMyChatsRequest
+	if len(frame.Payload) > 0 {
+		if err := json.Unmarshal(frame.Payload, &req); err != nil {
+			c.sendError(frame, errCodeInvalidArgument, "invalid get_my_chats payload")
+			return
+		}
+	}
+
+	grpcResp, err := c.chatClient.GetMyChats(c.createAuthContext(), &chatv1.GetMyChatsRequest{
+		IncludeArchived: req.IncludeArchived,
+		PageSize:        req.PageSize,
+		PageToken:       req.PageToken,
+	})
 	if err != nil {
 		log.Printf("failed to get chats via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
 		return
 	}
 
 	wsChats := make([]ChatInfo, 0, len(grpcResp.GetChats()))
 	for _, grpcChat := range grpcResp.GetChats() {
 		wsChats = append(wsChats, ChatInfo{
-			ID:   grpcChat.GetId(),
-			Name: grpcChat.GetName(),
+			ID:             grpcChat.GetId(),
+			Name:           grpcChat.GetName(),
+			UnreadMentions: grpcChat.GetUnreadMentions(),
+			MessageTTL:     grpcChat.GetMessageTtlSeconds(),
+			Draft:          fromProtoDraft(grpcChat.GetDraft()),
+			Settings:       fromProtoChatSettings(grpcChat.GetId(), grpcChat.GetSettings()),
+			LastMessage:    fromProtoMessagePreview(grpcChat.GetLastMessage()),
+			LastActivityAt: grpcChat.GetLastActivityAt().AsTime(),
 		})
 	}
 
 	wsResp := MyChatsResponse{
-		Chats: wsChats,
+		Chats:         wsChats,
+		NextPageToken: grpcResp.GetNextPageToken(),
 	}
 
-	wsMsg, err := NewWsMessage("my_chats_list", wsResp)
-	if err != nil {
-		log.Printf("failed to create my_chats_list message: %v", err)
-		return
-	}
-
-	c.send <- wsMsg
+	c.reply(frame, "my_chats_list", wsResp)
 }
 
-func (c *Client) handleGetChatHistory(payload json.RawMessage) {
-	if c.UserID == 0 {
+func (c *Client) handleGetChatHistory(frame WsMessage) {
+	if !c.requireAuth(frame) {
 		return
 	}
 
 	var req GetChatHistoryRequest
-	if err := json.Unmarshal(payload, &req); err != nil {
-		log.Printf("failed to unmarshal get_chat_history payload: %v", err)
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid get_chat_history payload")
 		return
 	}
 
 	stream, err := c.chatClient.GetChatHistory(c.createAuthContext(), &chatv1.GetChatHistoryRequest{ChatId: req.ChatID})
 	if err != nil {
 		log.Printf("failed to call GetChatHistory gRPC: %v", err)
+		c.sendRPCError(frame, err)
 		return
 	}
 
@@ -252,18 +413,715 @@ func (c *Client) handleGetChatHistory(payload json.RawMessage) {
 		}
 		if err != nil {
 			log.Printf("error receiving from GetChatHistory stream: %v", err)
+			c.sendRPCError(frame, err)
 			return
 		}
-		history = append(history, models.Message{
-			ID:       msg.Id,
-			ChatID:   msg.ChatId,
-			SenderID: msg.SenderId,
-			Text:     msg.Text,
-			SentAt:   msg.SentAt.AsTime(),
-		})
+		history = append(history, fromProtoMessage(msg))
 	}
 
 	wsResp := ChatHistoryResponse{Messages: history}
-	wsMsg, _ := NewWsMessage("chat_history", wsResp)
-	c.send <- wsMsg
+	c.reply(frame, "chat_history", wsResp)
+}
+
+func (c *Client) handleSearchMessages(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req SearchMessagesRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid search_messages payload")
+		return
+	}
+
+	grpcReq := &chatv1.SearchMessagesRequest{
+		Query:     req.Query,
+		ChatId:    req.ChatID,
+		SenderId:  req.SenderID,
+		PageSize:  req.PageSize,
+		PageToken: req.PageToken,
+	}
+	if req.From != nil {
+		grpcReq.From = timestamppb.New(*req.From)
+	}
+	if req.To != nil {
+		grpcReq.To = timestamppb.New(*req.To)
+	}
+
+	grpcResp, err := c.chatClient.SearchMessages(c.createAuthContext(), grpcReq)
+	if err != nil {
+		log.Printf("failed to search messages via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	hits := make([]SearchHit, 0, len(grpcResp.GetResults()))
+	for _, hit := range grpcResp.GetResults() {
+		highlights := make([]TextRange, 0, len(hit.GetHighlights()))
+		for _, h := range hit.GetHighlights() {
+			highlights = append(highlights, TextRange{Offset: h.GetOffset(), Length: h.GetLength()})
+		}
+
+		hits = append(hits, SearchHit{
+			Message:    fromProtoMessage(hit.GetMessage()),
+			Snippet:    hit.GetSnippet(),
+			Highlights: highlights,
+		})
+	}
+
+	wsResp := SearchResultsResponse{
+		Results:       hits,
+		NextPageToken: grpcResp.GetNextPageToken(),
+	}
+
+	c.reply(frame, "search_results", wsResp)
+}
+
+func fromProtoMessage(msg *chatv1.Message) models.Message {
+	return models.Message{
+		ID:       msg.GetId(),
+		ChatID:   msg.GetChatId(),
+		SenderID: msg.GetSenderId(),
+		Text:     msg.GetText(),
+		SentAt:   msg.GetSentAt().AsTime(),
+		Pinned:   msg.GetPinned(),
+		Mentions: fromProtoMentions(msg.GetMentions()),
+		Entities: convert.FromProtoEntities(msg.GetEntities()),
+
+		LinkPreview:   fromProtoLinkPreview(msg.GetLinkPreview()),
+		ForwardedFrom: fromProtoForwardedFrom(msg.GetForwardedFrom()),
+		ExpiresAt:     optionalTime(msg.GetExpiresAt()),
+		Poll:          fromProtoPoll(msg.GetPoll()),
+	}
+}
+
+func fromProtoPoll(p *chatv1.Poll) *models.Poll {
+	if p == nil {
+		return nil
+	}
+
+	options := make([]models.PollOption, 0, len(p.GetOptions()))
+	for _, o := range p.GetOptions() {
+		options = append(options, models.PollOption{
+			Text:   o.GetText(),
+			Votes:  int(o.GetVotes()),
+			Voters: o.GetVoters(),
+			Chosen: o.GetChosen(),
+		})
+	}
+
+	return &models.Poll{
+		Question:       p.GetQuestion(),
+		Options:        options,
+		MultipleChoice: p.GetMultipleChoice(),
+		Anonymous:      p.GetAnonymous(),
+		ClosesAt:       optionalTime(p.GetClosesAt()),
+		Closed:         p.GetClosed(),
+		TotalVoters:    int(p.GetTotalVoters()),
+	}
+}
+
+func optionalTime(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+func fromProtoForwardedFrom(f *chatv1.ForwardedFrom) *models.ForwardedFrom {
+	if f == nil {
+		return nil
+	}
+	return &models.ForwardedFrom{
+		ChatID:       f.GetChatId(),
+		MessageID:    f.GetMessageId(),
+		SenderID:     f.GetSenderId(),
+		SenderHidden: f.GetSenderHidden(),
+		SentAt:       f.GetSentAt().AsTime(),
+	}
+}
+
+func fromProtoLinkPreview(p *chatv1.LinkPreview) *models.LinkPreview {
+	if p == nil {
+		return nil
+	}
+	return &models.LinkPreview{
+		URL:         p.GetUrl(),
+		Title:       p.GetTitle(),
+		Description: p.GetDescription(),
+		ImageURL:    p.GetImageUrl(),
+		SiteName:    p.GetSiteName(),
+	}
+}
+
+func fromProtoMentions(grpcMentions []*chatv1.Mention) []models.Mention {
+	if len(grpcMentions) == 0 {
+		return nil
+	}
+
+	mentions := make([]models.Mention, 0, len(grpcMentions))
+	for _, m := range grpcMentions {
+		mentions = append(mentions, models.Mention{
+			Offset: int(m.GetOffset()),
+			Length: int(m.GetLength()),
+			UserID: m.GetUserId(),
+			All:    m.GetAll(),
+		})
+	}
+	return mentions
+}
+
+func (c *Client) handlePinMessage(frame WsMessage, pin bool) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req PinMessageRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid pin payload")
+		return
+	}
+
+	var err error
+	if pin {
+		_, err = c.chatClient.PinMessage(c.createAuthContext(), &chatv1.PinMessageRequest{
+			ChatId:    req.ChatID,
+			MessageId: req.MessageID,
+		})
+	} else {
+		_, err = c.chatClient.UnpinMessage(c.createAuthContext(), &chatv1.UnpinMessageRequest{
+			ChatId:    req.ChatID,
+			MessageId: req.MessageID,
+		})
+	}
+
+	if err != nil {
+		log.Printf("failed to change pinned state via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	c.ok(frame)
+}
+
+func (c *Client) handleGetPinnedMessages(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req GetPinnedMessagesRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid get_pinned_messages payload")
+		return
+	}
+
+	grpcResp, err := c.chatClient.GetPinnedMessages(c.createAuthContext(), &chatv1.GetPinnedMessagesRequest{ChatId: req.ChatID})
+	if err != nil {
+		log.Printf("failed to get pinned messages via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	pinned := make([]PinnedMessage, 0, len(grpcResp.GetMessages()))
+	for _, pm := range grpcResp.GetMessages() {
+		pinned = append(pinned, PinnedMessage{
+			Message:  fromProtoMessage(pm.GetMessage()),
+			PinnedBy: pm.GetPinnedBy(),
+			PinnedAt: pm.GetPinnedAt().AsTime(),
+		})
+	}
+
+	c.reply(frame, "pinned_messages", PinnedMessagesResponse{ChatID: req.ChatID, Messages: pinned})
+}
+
+func (c *Client) handleGetMentions(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req GetMentionsRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid get_mentions payload")
+		return
+	}
+
+	grpcResp, err := c.chatClient.GetMentions(c.createAuthContext(), &chatv1.GetMentionsRequest{
+		PageSize:   req.PageSize,
+		PageToken:  req.PageToken,
+		UnreadOnly: req.UnreadOnly,
+	})
+	if err != nil {
+		log.Printf("failed to get mentions via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	mentioned := make([]MentionedMessage, 0, len(grpcResp.GetMentions()))
+	for _, mm := range grpcResp.GetMentions() {
+		mentioned = append(mentioned, MentionedMessage{
+			Message: fromProtoMessage(mm.GetMessage()),
+			Read:    mm.GetRead(),
+		})
+	}
+
+	c.reply(frame, "mentions_list", MentionsResponse{
+		Mentions:      mentioned,
+		NextPageToken: grpcResp.GetNextPageToken(),
+	})
+}
+
+func (c *Client) handleMarkMentionsRead(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req MarkMentionsReadRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid mark_mentions_read payload")
+		return
+	}
+
+	_, err := c.chatClient.MarkMentionsRead(c.createAuthContext(), &chatv1.MarkMentionsReadRequest{ChatId: req.ChatID})
+	if err != nil {
+		log.Printf("failed to mark mentions read via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	c.ok(frame)
+}
+
+func (c *Client) handleForwardMessages(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req ForwardMessagesRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid forward_messages payload")
+		return
+	}
+
+	_, err := c.chatClient.ForwardMessages(c.createAuthContext(), &chatv1.ForwardMessagesRequest{
+		FromChatId: req.FromChatID,
+		MessageIds: req.MessageIDs,
+		ToChatId:   req.ToChatID,
+	})
+	if err != nil {
+		log.Printf("failed to forward messages via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	c.ok(frame)
+}
+
+func (c *Client) handleSetMessageTTL(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req SetMessageTTLRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid set_message_ttl payload")
+		return
+	}
+
+	_, err := c.chatClient.SetMessageTTL(c.createAuthContext(), &chatv1.SetMessageTTLRequest{
+		ChatId:     req.ChatID,
+		TtlSeconds: req.TTLSeconds,
+	})
+	if err != nil {
+		log.Printf("failed to set message ttl via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	c.ok(frame)
+}
+
+func (c *Client) handleCreatePoll(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req CreatePollRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid create_poll payload")
+		return
+	}
+
+	grpcReq := &chatv1.CreatePollRequest{
+		ChatId:         req.ChatID,
+		Question:       req.Question,
+		Options:        req.Options,
+		MultipleChoice: req.MultipleChoice,
+		Anonymous:      req.Anonymous,
+	}
+	if req.ClosesAt != nil {
+		grpcReq.ClosesAt = timestamppb.New(*req.ClosesAt)
+	}
+
+	if _, err := c.chatClient.CreatePoll(c.createAuthContext(), grpcReq); err != nil {
+		log.Printf("failed to create poll via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	c.ok(frame)
+}
+
+// handleVote casts or retracts a vote. The voter gets the poll back with
+// their own choices marked; everyone else gets the tallies via poll_updated.
+func (c *Client) handleVote(frame WsMessage, vote bool) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req VoteRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid vote payload")
+		return
+	}
+
+	var poll *chatv1.Poll
+	if vote {
+		grpcResp, err := c.chatClient.Vote(c.createAuthContext(), &chatv1.VoteRequest{
+			ChatId:    req.ChatID,
+			MessageId: req.MessageID,
+			OptionIds: req.OptionIDs,
+		})
+		if err != nil {
+			log.Printf("failed to vote via gRPC for user %d: %v", c.UserID, err)
+			c.sendRPCError(frame, err)
+			return
+		}
+		poll = grpcResp.GetPoll()
+	} else {
+		grpcResp, err := c.chatClient.RetractVote(c.createAuthContext(), &chatv1.RetractVoteRequest{
+			ChatId:    req.ChatID,
+			MessageId: req.MessageID,
+		})
+		if err != nil {
+			log.Printf("failed to retract vote via gRPC for user %d: %v", c.UserID, err)
+			c.sendRPCError(frame, err)
+			return
+		}
+		poll = grpcResp.GetPoll()
+	}
+	if poll == nil {
+		log.Printf("vote response for message %s came back without a poll", req.MessageID)
+		c.sendError(frame, errCodeInternal, "internal error")
+		return
+	}
+
+	c.reply(frame, "poll_vote_result", models.PollUpdated{
+		ChatID:    req.ChatID,
+		MessageID: req.MessageID,
+		Poll:      *fromProtoPoll(poll),
+	})
+}
+
+func fromProtoDraft(d *chatv1.Draft) *models.Draft {
+	if d == nil {
+		return nil
+	}
+	return &models.Draft{
+		ChatID:    d.GetChatId(),
+		Text:      d.GetText(),
+		Entities:  convert.FromProtoEntities(d.GetEntities()),
+		UpdatedAt: d.GetUpdatedAt().AsTime(),
+	}
+}
+
+func (c *Client) handleSaveDraft(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req SaveDraftRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid save_draft payload")
+		return
+	}
+
+	_, err := c.chatClient.SaveDraft(c.createAuthContext(), &chatv1.SaveDraftRequest{
+		ChatId:    req.ChatID,
+		Text:      req.Text,
+		Entities:  convert.ToProtoEntities(req.Entities),
+		SessionId: c.sessionID,
+	})
+	if err != nil {
+		log.Printf("failed to save draft via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	c.ok(frame)
+}
+
+func (c *Client) handleGetDrafts(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	grpcResp, err := c.chatClient.GetDrafts(c.createAuthContext(), &chatv1.GetDraftsRequest{})
+	if err != nil {
+		log.Printf("failed to get drafts via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	drafts := make([]models.Draft, 0, len(grpcResp.GetDrafts()))
+	for _, d := range grpcResp.GetDrafts() {
+		drafts = append(drafts, *fromProtoDraft(d))
+	}
+
+	c.reply(frame, "drafts_list", DraftsResponse{Drafts: drafts})
+}
+
+func fromProtoMessagePreview(p *chatv1.MessagePreview) *MessagePreview {
+	if p == nil {
+		return nil
+	}
+	return &MessagePreview{
+		ID:       p.GetId(),
+		SenderID: p.GetSenderId(),
+		Snippet:  p.GetSnippet(),
+		SentAt:   p.GetSentAt().AsTime(),
+	}
+}
+
+func fromProtoChatSettings(chatID string, settings *chatv1.ChatSettings) models.ChatSettings {
+	return models.ChatSettings{
+		ChatID:     chatID,
+		MutedUntil: optionalTime(settings.GetMutedUntil()),
+		Archived:   settings.GetArchived(),
+		Pinned:     settings.GetPinned(),
+		SortOrder:  int(settings.GetSortOrder()),
+	}
+}
+
+func (c *Client) handleUpdateChatSettings(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req UpdateChatSettingsRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid update_chat_settings payload")
+		return
+	}
+
+	grpcReq := &chatv1.UpdateChatSettingsRequest{
+		ChatId:    req.ChatID,
+		Unmute:    req.Unmute,
+		Archived:  req.Archived,
+		Pinned:    req.Pinned,
+		SortOrder: req.SortOrder,
+	}
+	if req.MutedUntil != nil {
+		grpcReq.MutedUntil = timestamppb.New(*req.MutedUntil)
+	}
+
+	// The new settings come back to every session as chat_settings_updated.
+	if _, err := c.chatClient.UpdateChatSettings(c.createAuthContext(), grpcReq); err != nil {
+		log.Printf("failed to update chat settings via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	c.ok(frame)
+}
+
+func fromProtoScheduledMessage(msg *chatv1.ScheduledMessage) ScheduledMessage {
+	return ScheduledMessage{
+		ID:        msg.GetId(),
+		ChatID:    msg.GetChatId(),
+		Text:      msg.GetText(),
+		Entities:  convert.FromProtoEntities(msg.GetEntities()),
+		SendAt:    msg.GetSendAt().AsTime(),
+		CreatedAt: msg.GetCreatedAt().AsTime(),
+	}
+}
+
+func (c *Client) handleScheduleMessage(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req ScheduleMessageRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid schedule_message payload")
+		return
+	}
+
+	grpcResp, err := c.chatClient.ScheduleMessage(c.createAuthContext(), &chatv1.ScheduleMessageRequest{
+		ChatId:   req.ChatID,
+		Text:     req.Text,
+		Entities: convert.ToProtoEntities(req.Entities),
+		SendAt:   timestamppb.New(req.SendAt),
+	})
+	if err != nil {
+		log.Printf("failed to schedule message via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	c.reply(frame, "scheduled_message", fromProtoScheduledMessage(grpcResp.GetScheduledMessage()))
+}
+
+func (c *Client) handleUpdateScheduledMessage(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req UpdateScheduledMessageRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid update_scheduled_message payload")
+		return
+	}
+
+	grpcResp, err := c.chatClient.UpdateScheduledMessage(c.createAuthContext(), &chatv1.UpdateScheduledMessageRequest{
+		Id:       req.ID,
+		Text:     req.Text,
+		Entities: convert.ToProtoEntities(req.Entities),
+		SendAt:   timestamppb.New(req.SendAt),
+	})
+	if err != nil {
+		log.Printf("failed to update scheduled message via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	c.reply(frame, "scheduled_message", fromProtoScheduledMessage(grpcResp.GetScheduledMessage()))
+}
+
+func (c *Client) handleCancelScheduledMessage(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req CancelScheduledMessageRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid cancel_scheduled_message payload")
+		return
+	}
+
+	_, err := c.chatClient.CancelScheduledMessage(c.createAuthContext(), &chatv1.CancelScheduledMessageRequest{Id: req.ID})
+	if err != nil {
+		log.Printf("failed to cancel scheduled message via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	c.ok(frame)
+}
+
+func (c *Client) handleGetScheduledMessages(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req GetScheduledMessagesRequest
+	if len(frame.Payload) > 0 {
+		if err := json.Unmarshal(frame.Payload, &req); err != nil {
+			c.sendError(frame, errCodeInvalidArgument, "invalid get_scheduled_messages payload")
+			return
+		}
+	}
+
+	grpcResp, err := c.chatClient.ListScheduledMessages(c.createAuthContext(), &chatv1.ListScheduledMessagesRequest{ChatId: req.ChatID})
+	if err != nil {
+		log.Printf("failed to list scheduled messages via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	scheduled := make([]ScheduledMessage, 0, len(grpcResp.GetScheduledMessages()))
+	for _, msg := range grpcResp.GetScheduledMessages() {
+		scheduled = append(scheduled, fromProtoScheduledMessage(msg))
+	}
+
+	c.reply(frame, "scheduled_messages", ScheduledMessagesResponse{Messages: scheduled})
+}
+
+func (c *Client) handleBlockUser(frame WsMessage, block bool) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req BlockUserRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid block payload")
+		return
+	}
+
+	var err error
+	if block {
+		_, err = c.userClient.BlockUser(c.createAuthContext(), &userv1.BlockUserRequest{UserId: req.UserID})
+	} else {
+		_, err = c.userClient.UnblockUser(c.createAuthContext(), &userv1.UnblockUserRequest{UserId: req.UserID})
+	}
+	if err != nil {
+		log.Printf("failed to update block via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	c.ok(frame)
+}
+
+func (c *Client) handleGetBlockedUsers(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	grpcResp, err := c.userClient.ListBlocked(c.createAuthContext(), &userv1.ListBlockedRequest{})
+	if err != nil {
+		log.Printf("failed to list blocked users via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	users := make([]BlockedUser, 0, len(grpcResp.GetUsers()))
+	for _, u := range grpcResp.GetUsers() {
+		users = append(users, BlockedUser{
+			ID:        u.GetUser().GetId(),
+			Username:  u.GetUser().GetUsername(),
+			BlockedAt: u.GetBlockedAt().AsTime(),
+		})
+	}
+
+	c.reply(frame, "blocked_users", BlockedUsersResponse{Users: users})
+}
+
+func (c *Client) handleSearchUsers(frame WsMessage) {
+	if !c.requireAuth(frame) {
+		return
+	}
+
+	var req SearchUsersRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		c.sendError(frame, errCodeInvalidArgument, "invalid search_users payload")
+		return
+	}
+
+	grpcResp, err := c.userClient.SearchUsers(c.createAuthContext(), &userv1.SearchUsersRequest{
+		Query:    req.Query,
+		PageSize: req.PageSize,
+	})
+	if err != nil {
+		log.Printf("failed to search users via gRPC for user %d: %v", c.UserID, err)
+		c.sendRPCError(frame, err)
+		return
+	}
+
+	users := make([]UserSummary, 0, len(grpcResp.GetUsers()))
+	for _, u := range grpcResp.GetUsers() {
+		users = append(users, UserSummary{ID: u.GetId(), Username: u.GetUsername()})
+	}
+
+	c.reply(frame, "user_search_results", SearchUsersResponse{Query: req.Query, Users: users})
 }
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_messages_search_vector;
+ALTER TABLE messages DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE messages DROP COLUMN IF EXISTS search_config;
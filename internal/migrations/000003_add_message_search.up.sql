@@ -0,0 +1,5 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS search_config REGCONFIG NOT NULL DEFAULT 'simple';
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+    GENERATED ALWAYS AS (to_tsvector(search_config, text)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_messages_search_vector ON messages USING GIN (search_vector);
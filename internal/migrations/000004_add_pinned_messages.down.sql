@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS pinned_messages;
+ALTER TABLE chat_members DROP COLUMN IF EXISTS role;
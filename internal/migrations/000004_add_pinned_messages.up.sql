@@ -0,0 +1,25 @@
+ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'member';
+
+-- Chats created before roles existed have no recorded creator. The member
+-- who wrote a chat's first message stands in for it, or, in a chat without
+-- messages, the member who signed up first. Everyone else stays a member.
+UPDATE chat_members cm SET role = 'admin'
+WHERE cm.user_id = COALESCE(
+    (SELECT m.sender_id
+     FROM messages m
+     JOIN chat_members author ON author.chat_id = m.chat_id AND author.user_id = m.sender_id
+     WHERE m.chat_id = cm.chat_id
+     ORDER BY m.sent_at, m.id
+     LIMIT 1),
+    (SELECT MIN(other.user_id) FROM chat_members other WHERE other.chat_id = cm.chat_id)
+);
+
+CREATE TABLE IF NOT EXISTS pinned_messages (
+    chat_id UUID NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    pinned_by BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    pinned_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (chat_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pinned_messages_chat_id_pinned_at ON pinned_messages(chat_id, pinned_at DESC);
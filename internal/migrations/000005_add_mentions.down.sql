@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS mentions;
+ALTER TABLE messages DROP COLUMN IF EXISTS mentions;
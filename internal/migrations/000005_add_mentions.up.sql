@@ -0,0 +1,13 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS mentions JSONB NOT NULL DEFAULT '[]';
+
+CREATE TABLE IF NOT EXISTS mentions (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    chat_id UUID NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+    sent_at TIMESTAMPTZ NOT NULL,
+    read_at TIMESTAMPTZ,
+    PRIMARY KEY (user_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_user_id_sent_at ON mentions(user_id, sent_at DESC, message_id DESC);
+CREATE INDEX IF NOT EXISTS idx_mentions_unread ON mentions(user_id, chat_id) WHERE read_at IS NULL;
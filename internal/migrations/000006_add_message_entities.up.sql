@@ -0,0 +1 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS entities JSONB NOT NULL DEFAULT '[]';
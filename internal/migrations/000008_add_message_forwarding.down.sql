@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS hide_forward_sender;
+ALTER TABLE messages DROP COLUMN IF EXISTS forwarded_from;
@@ -0,0 +1,2 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from JSONB;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS hide_forward_sender BOOLEAN NOT NULL DEFAULT FALSE;
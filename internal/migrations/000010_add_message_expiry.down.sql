@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_messages_expires_at;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS expires_at;
+
+ALTER TABLE chats DROP COLUMN IF EXISTS message_ttl_seconds;
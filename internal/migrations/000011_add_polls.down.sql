@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS poll_votes;
+
+DROP TABLE IF EXISTS polls;
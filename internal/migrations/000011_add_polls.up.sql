@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS polls (
+    message_id UUID PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    question TEXT NOT NULL,
+    options JSONB NOT NULL,
+    multiple_choice BOOLEAN NOT NULL DEFAULT FALSE,
+    anonymous BOOLEAN NOT NULL DEFAULT FALSE,
+    closes_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+    message_id UUID NOT NULL REFERENCES polls(message_id) ON DELETE CASCADE,
+    option_index SMALLINT NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    voted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (message_id, user_id, option_index)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE chat_members DROP COLUMN IF EXISTS sort_order;
+ALTER TABLE chat_members DROP COLUMN IF EXISTS pinned;
+ALTER TABLE chat_members DROP COLUMN IF EXISTS archived;
+ALTER TABLE chat_members DROP COLUMN IF EXISTS muted_until;
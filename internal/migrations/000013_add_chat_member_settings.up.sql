@@ -0,0 +1,4 @@
+ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS muted_until TIMESTAMPTZ;
+ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS pinned BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS sort_order INTEGER NOT NULL DEFAULT 0;
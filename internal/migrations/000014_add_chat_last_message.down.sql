@@ -0,0 +1,2 @@
+ALTER TABLE chats DROP COLUMN IF EXISTS last_message_at;
+ALTER TABLE chats DROP COLUMN IF EXISTS last_message_id;
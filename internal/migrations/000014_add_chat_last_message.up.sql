@@ -0,0 +1,16 @@
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS last_message_id UUID REFERENCES messages(id) ON DELETE SET NULL;
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS last_message_at TIMESTAMPTZ;
+
+UPDATE chats c
+SET last_message_id = lm.id, last_message_at = lm.sent_at
+FROM (
+    SELECT DISTINCT ON (chat_id) chat_id, id, sent_at
+    FROM messages
+    ORDER BY chat_id, sent_at DESC, id DESC
+) lm
+WHERE lm.chat_id = c.id;
+
+UPDATE chats SET last_message_at = created_at WHERE last_message_at IS NULL;
+
+ALTER TABLE chats ALTER COLUMN last_message_at SET DEFAULT NOW();
+ALTER TABLE chats ALTER COLUMN last_message_at SET NOT NULL;
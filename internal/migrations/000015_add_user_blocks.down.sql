@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_username_lower;
+
+DROP TABLE IF EXISTS user_blocks;
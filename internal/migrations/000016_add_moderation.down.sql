@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS moderation_actions;
+
+DROP TABLE IF EXISTS reports;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS suspension_reason,
+    DROP COLUMN IF EXISTS suspended_until,
+    DROP COLUMN IF EXISTS is_moderator;
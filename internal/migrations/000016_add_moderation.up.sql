@@ -0,0 +1,41 @@
+-- Moderators are granted by hand: UPDATE users SET is_moderator = TRUE WHERE id = ...
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS is_moderator BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS suspended_until TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS suspension_reason TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    reporter_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reported_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chat_id UUID REFERENCES chats(id) ON DELETE SET NULL,
+    message_id UUID REFERENCES messages(id) ON DELETE SET NULL,
+    message_text TEXT,
+    reason TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open',
+    resolved_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    resolution_note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ,
+    CHECK (reporter_id <> reported_user_id),
+    CHECK (status IN ('open', 'resolved', 'dismissed'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_reports_status_created_at ON reports(status, created_at, id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_open_message
+    ON reports(reporter_id, message_id) WHERE status = 'open' AND message_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS moderation_actions (
+    id BIGSERIAL PRIMARY KEY,
+    moderator_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    target_user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    message_id UUID,
+    report_id UUID REFERENCES reports(id) ON DELETE SET NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_target_user_id ON moderation_actions(target_user_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_outbox_chat_pending;
+
+ALTER TABLE outbox DROP COLUMN IF EXISTS dead_at;
+ALTER TABLE outbox DROP COLUMN IF EXISTS claimed_until;
+ALTER TABLE outbox DROP COLUMN IF EXISTS chat_id;
@@ -0,0 +1,7 @@
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS chat_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMPTZ;
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS dead_at TIMESTAMPTZ;
+
+UPDATE outbox SET chat_id = COALESCE(event->>'chat_id', '');
+
+CREATE INDEX IF NOT EXISTS idx_outbox_chat_pending ON outbox(chat_id, id) WHERE dead_at IS NULL;
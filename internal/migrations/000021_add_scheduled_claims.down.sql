@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_scheduled_messages_sending;
+
+UPDATE scheduled_messages SET status = 'pending' WHERE status = 'sending';
+
+ALTER TABLE scheduled_messages DROP COLUMN IF EXISTS claimed_until;
+ALTER TABLE scheduled_messages DROP COLUMN IF EXISTS retry_at;
+ALTER TABLE scheduled_messages DROP COLUMN IF EXISTS attempts;
@@ -0,0 +1,5 @@
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS retry_at TIMESTAMPTZ;
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_sending ON scheduled_messages(claimed_until) WHERE status = 'sending';
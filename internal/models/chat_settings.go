@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// ChatSettings are a member's personal preferences for a chat in their chat
+// list. Pinned chats come first, ordered by SortOrder.
+type ChatSettings struct {
+	ChatID     string     `json:"chat_id"`
+	MutedUntil *time.Time `json:"muted_until,omitempty"`
+	Archived   bool       `json:"archived"`
+	Pinned     bool       `json:"pinned"`
+	SortOrder  int        `json:"sort_order"`
+}
+
+// Muted reports whether notifications for the chat are silenced at now.
+func (s ChatSettings) Muted(now time.Time) bool {
+	return s.MutedUntil != nil && s.MutedUntil.After(now)
+}
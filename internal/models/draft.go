@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Draft is the unsent text a user has typed in a chat. An empty Text means
+// the draft was cleared.
+type Draft struct {
+	ChatID    string    `json:"chat_id"`
+	Text      string    `json:"text"`
+	Entities  []Entity  `json:"entities,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
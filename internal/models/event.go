@@ -0,0 +1,49 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event is the envelope published by the chat service and relayed by the
+// WebSocket hub as a message of the same Type. It goes to every member of
+// ChatID unless UserIDs narrows the audience. ExceptSession names a gateway
+// session that is skipped, typically the one the change came from. Events
+// about a message carry its SenderID so that users who blocked the sender
+// are left out. Seqs holds each recipient's sequence number for the event,
+// once it has been recorded in their journal.
+type Event struct {
+	Type          string          `json:"type"`
+	ChatID        string          `json:"chat_id"`
+	UserIDs       []int64         `json:"user_ids,omitempty"`
+	ExceptSession string          `json:"except_session,omitempty"`
+	SenderID      int64           `json:"sender_id,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+	Seqs          map[int64]int64 `json:"seqs,omitempty"`
+}
+
+type MessagePinned struct {
+	ChatID    string    `json:"chat_id"`
+	MessageID string    `json:"message_id"`
+	Pinned    bool      `json:"pinned"`
+	ChangedBy int64     `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+type MessagesExpired struct {
+	ChatID     string   `json:"chat_id"`
+	MessageIDs []string `json:"message_ids"`
+}
+
+type MessageTTLChanged struct {
+	ChatID     string    `json:"chat_id"`
+	TTLSeconds int64     `json:"ttl_seconds"`
+	ChangedBy  int64     `json:"changed_by"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+type PollUpdated struct {
+	ChatID    string `json:"chat_id"`
+	MessageID string `json:"message_id"`
+	Poll      Poll   `json:"poll"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// FilterDecision records a content filter acting on a message, for review
+// by moderators. MessageID is nil when the message was rejected. Text is
+// the message as the sender wrote it, before any masking.
+type FilterDecision struct {
+	ID        int64
+	ChatID    string
+	SenderID  int64
+	MessageID *string
+	Filter    string
+	Action    string
+	Reason    string
+	Text      string
+	CreatedAt time.Time
+}
@@ -8,4 +8,65 @@ type Message struct {
 	SenderID int64     `json:"sender_id"`
 	Text     string    `json:"text"`
 	SentAt   time.Time `json:"sent_at"`
+	Pinned   bool      `json:"pinned"`
+	Mentions []Mention `json:"mentions,omitempty"`
+	Entities []Entity  `json:"entities,omitempty"`
+
+	LinkPreview   *LinkPreview   `json:"link_preview,omitempty"`
+	ForwardedFrom *ForwardedFrom `json:"forwarded_from,omitempty"`
+	ExpiresAt     *time.Time     `json:"expires_at,omitempty"`
+	Poll          *Poll          `json:"poll,omitempty"`
+	// ClientMessageID is the sender's own id for the message. It is only
+	// set on the new_message event, so the sender can match it to the
+	// message it displayed before the server confirmed it.
+	ClientMessageID string `json:"client_message_id,omitempty"`
+}
+
+// ForwardedFrom points at the original message of a forwarded copy. Copies
+// of copies keep pointing at the original. SenderID is zero when the
+// original sender chose to hide their name on forwards.
+type ForwardedFrom struct {
+	ChatID       string    `json:"chat_id"`
+	MessageID    string    `json:"message_id"`
+	SenderID     int64     `json:"sender_id,omitempty"`
+	SenderHidden bool      `json:"sender_hidden,omitempty"`
+	SentAt       time.Time `json:"sent_at"`
+}
+
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// Mention marks an @username (UserID set) or @all (All set) token in the
+// message text. Offset and Length are counted in Unicode code points.
+type Mention struct {
+	Offset int   `json:"offset"`
+	Length int   `json:"length"`
+	UserID int64 `json:"user_id,omitempty"`
+	All    bool  `json:"all,omitempty"`
+}
+
+const (
+	EntityBold          = "bold"
+	EntityItalic        = "italic"
+	EntityStrikethrough = "strikethrough"
+	EntityCode          = "code"
+	EntityPre           = "pre"
+	EntityLink          = "link"
+	EntityMention       = "mention"
+)
+
+// Entity describes formatting applied to a range of the message text,
+// addressed in Unicode code points. Clients render the text as plain text
+// and apply entities on top; the text itself never carries markup.
+type Entity struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	URL    string `json:"url,omitempty"`
+	UserID int64  `json:"user_id,omitempty"`
 }
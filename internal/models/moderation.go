@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// EventAccountSuspended is sent to every session of a suspended user. The
+// WebSocket hub closes those sessions once it has been delivered.
+const EventAccountSuspended = "account_suspended"
+
+type AccountSuspended struct {
+	// Until is nil for an indefinite suspension.
+	Until  *time.Time `json:"until,omitempty"`
+	Reason string     `json:"reason,omitempty"`
+}
+
+type MessageDeleted struct {
+	ChatID    string `json:"chat_id"`
+	MessageID string `json:"message_id"`
+}
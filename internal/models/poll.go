@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Poll is attached to the message that carries its question. Options are
+// addressed by their index.
+type Poll struct {
+	Question       string       `json:"question"`
+	Options        []PollOption `json:"options"`
+	MultipleChoice bool         `json:"multiple_choice"`
+	Anonymous      bool         `json:"anonymous"`
+	ClosesAt       *time.Time   `json:"closes_at,omitempty"`
+	Closed         bool         `json:"closed"`
+	TotalVoters    int          `json:"total_voters"`
+}
+
+// PollOption holds the tally of one answer. Voters is only filled in for
+// polls that are not anonymous; Chosen is relative to the user the poll was
+// loaded for.
+type PollOption struct {
+	Text   string  `json:"text"`
+	Votes  int     `json:"votes"`
+	Voters []int64 `json:"voters,omitempty"`
+	Chosen bool    `json:"chosen,omitempty"`
+}
@@ -0,0 +1,48 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (r *postgresRepository) IsBlocked(ctx context.Context, blockerID, blockedID int64) (bool, error) {
+	query := "SELECT EXISTS(SELECT 1 FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2)"
+	var blocked bool
+	if err := r.db.QueryRow(ctx, query, blockerID, blockedID).Scan(&blocked); err != nil {
+		return false, fmt.Errorf("failed to check block: %w", err)
+	}
+	return blocked, nil
+}
+
+// IsBlockedInDirectChat reports whether the chat is a direct chat between
+// two users and the other one has blocked senderID.
+func (r *postgresRepository) IsBlockedInDirectChat(ctx context.Context, chatID string, senderID int64) (bool, error) {
+	query := `
+		SELECT (SELECT COUNT(*) FROM chat_members WHERE chat_id = $1) = 2
+		   AND EXISTS(
+		       SELECT 1 FROM chat_members cm
+		       JOIN user_blocks b ON b.blocker_id = cm.user_id AND b.blocked_id = $2
+		       WHERE cm.chat_id = $1 AND cm.user_id <> $2
+		   )
+	`
+	var blocked bool
+	if err := r.db.QueryRow(ctx, query, chatID, senderID).Scan(&blocked); err != nil {
+		return false, fmt.Errorf("failed to check direct chat block: %w", err)
+	}
+	return blocked, nil
+}
+
+// GetBlockerIDs returns the users who have blocked userID.
+func (r *postgresRepository) GetBlockerIDs(ctx context.Context, userID int64) ([]int64, error) {
+	rows, err := r.db.Query(ctx, "SELECT blocker_id FROM user_blocks WHERE blocked_id = $1", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query blockers: %w", err)
+	}
+	blockerIDs, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan blockers: %w", err)
+	}
+	return blockerIDs, nil
+}
@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/models"
+)
+
+// SaveDraft stores the user's draft for a chat, or deletes it when the text
+// is empty, and returns the time of the change.
+func (r *postgresRepository) SaveDraft(ctx context.Context, userID int64, draft models.Draft) (time.Time, error) {
+	if draft.Text == "" {
+		query := "DELETE FROM drafts WHERE user_id = $1 AND chat_id = $2"
+		if _, err := r.db.Exec(ctx, query, userID, draft.ChatID); err != nil {
+			return time.Time{}, fmt.Errorf("failed to delete draft: %w", err)
+		}
+		return time.Now(), nil
+	}
+
+	entities := draft.Entities
+	if entities == nil {
+		entities = []models.Entity{}
+	}
+
+	query := `
+		INSERT INTO drafts (user_id, chat_id, text, entities)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, chat_id) DO UPDATE
+		SET text = EXCLUDED.text, entities = EXCLUDED.entities, updated_at = NOW()
+		RETURNING updated_at
+	`
+	var updatedAt time.Time
+	if err := r.db.QueryRow(ctx, query, userID, draft.ChatID, draft.Text, entities).Scan(&updatedAt); err != nil {
+		return time.Time{}, fmt.Errorf("failed to save draft: %w", err)
+	}
+	return updatedAt, nil
+}
+
+func (r *postgresRepository) GetDrafts(ctx context.Context, userID int64) ([]models.Draft, error) {
+	query := `
+		SELECT d.chat_id, d.text, d.entities, d.updated_at
+		FROM drafts d
+		JOIN chat_members cm ON cm.chat_id = d.chat_id AND cm.user_id = d.user_id
+		WHERE d.user_id = $1
+		ORDER BY d.updated_at DESC
+	`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query drafts: %w", err)
+	}
+	defer rows.Close()
+
+	var drafts []models.Draft
+	for rows.Next() {
+		var d models.Draft
+		if err := rows.Scan(&d.ChatID, &d.Text, &d.Entities, &d.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan draft row: %w", err)
+		}
+		drafts = append(drafts, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating draft rows: %w", err)
+	}
+
+	return drafts, nil
+}
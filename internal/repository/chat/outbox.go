@@ -0,0 +1,179 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// maxOutboxBackoffSeconds caps the wait before an event that keeps
+	// failing is tried again.
+	maxOutboxBackoffSeconds = 300
+	// maxOutboxAttempts is how often an event is tried before it is set
+	// aside as dead, so that it stops holding up its chat.
+	maxOutboxAttempts = 20
+	// outboxLease is how long a relay has to publish the events it
+	// claimed before other relays may claim them again.
+	outboxLease = time.Minute
+)
+
+// EventsFunc builds the events announcing a message once it is stored. It
+// runs inside the transaction that stores the message, and the events are
+// written to the outbox in that same transaction.
+type EventsFunc func(sent SentMessage) ([]models.Event, error)
+
+// RelayFunc publishes an event taken from the outbox.
+type RelayFunc func(ctx context.Context, event models.Event) error
+
+func insertOutboxEvents(ctx context.Context, tx pgx.Tx, events []models.Event) error {
+	for _, event := range events {
+		if _, err := tx.Exec(ctx, "INSERT INTO outbox (chat_id, event) VALUES ($1, $2)", event.ChatID, event); err != nil {
+			return fmt.Errorf("failed to write %s event to outbox: %w", event.Type, err)
+		}
+	}
+	return nil
+}
+
+type outboxRow struct {
+	id     int64
+	chatID string
+	event  models.Event
+}
+
+// RelayOutbox claims up to limit due outbox events and hands each one to
+// relay, returning how many were claimed. Relayed events are removed;
+// failed ones are tried again later, backing off exponentially, until
+// maxOutboxAttempts is reached and they are marked dead.
+//
+// Events of a chat are relayed in the order they were written: a relay
+// claims a chat as a whole through its oldest event, and an event that
+// fails holds back the later events of its chat until it is relayed or
+// dead. Claims are leased for outboxLease and publishing happens outside
+// any transaction; an event may be published twice if a relay dies or
+// overruns its lease.
+func (r *postgresRepository) RelayOutbox(ctx context.Context, limit int, relay RelayFunc) (int, error) {
+	claimed, err := r.claimOutbox(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	failedChats := make(map[string]bool)
+	for _, row := range claimed {
+		if failedChats[row.chatID] {
+			if err := r.releaseOutbox(ctx, row.id); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if err := relay(ctx, row.event); err != nil {
+			failedChats[row.chatID] = true
+			if err := r.retryOutbox(ctx, row.id, err); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if _, err := r.db.Exec(ctx, "DELETE FROM outbox WHERE id = $1", row.id); err != nil {
+			return 0, fmt.Errorf("failed to remove outbox event %d: %w", row.id, err)
+		}
+	}
+
+	return len(claimed), nil
+}
+
+// claimOutbox leases the pending events of chats whose oldest pending
+// event is due and unclaimed, oldest first.
+func (r *postgresRepository) claimOutbox(ctx context.Context, limit int) ([]outboxRow, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	headsQuery := `
+		SELECT o.chat_id
+		FROM outbox o
+		WHERE o.dead_at IS NULL
+			AND o.available_at <= NOW()
+			AND (o.claimed_until IS NULL OR o.claimed_until < NOW())
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox e
+				WHERE e.chat_id = o.chat_id AND e.id < o.id AND e.dead_at IS NULL
+			)
+		ORDER BY o.id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+	rows, err := tx.Query(ctx, headsQuery, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox chats: %w", err)
+	}
+	chatIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan outbox chats: %w", err)
+	}
+	if len(chatIDs) == 0 {
+		return nil, nil
+	}
+
+	claimQuery := `
+		UPDATE outbox
+		SET claimed_until = NOW() + make_interval(secs => $3)
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE chat_id = ANY($1) AND dead_at IS NULL
+			ORDER BY id
+			LIMIT $2
+		)
+		RETURNING id, chat_id, event
+	`
+	rows, err = tx.Query(ctx, claimQuery, chatIDs, limit, outboxLease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	var claimed []outboxRow
+	for rows.Next() {
+		var row outboxRow
+		if err := rows.Scan(&row.id, &row.chatID, &row.event); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan outbox row: %w", err)
+		}
+		claimed = append(claimed, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating outbox rows: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].id < claimed[j].id })
+	return claimed, nil
+}
+
+func (r *postgresRepository) retryOutbox(ctx context.Context, id int64, relayErr error) error {
+	query := `
+		UPDATE outbox
+		SET attempts = attempts + 1, last_error = $2, claimed_until = NULL,
+			available_at = NOW() + make_interval(secs => LEAST(power(2, attempts), $3)),
+			dead_at = CASE WHEN attempts + 1 >= $4 THEN NOW() END
+		WHERE id = $1
+	`
+	if _, err := r.db.Exec(ctx, query, id, relayErr.Error(), maxOutboxBackoffSeconds, maxOutboxAttempts); err != nil {
+		return fmt.Errorf("failed to reschedule outbox event %d: %w", id, err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) releaseOutbox(ctx context.Context, id int64) error {
+	if _, err := r.db.Exec(ctx, "UPDATE outbox SET claimed_until = NULL WHERE id = $1", id); err != nil {
+		return fmt.Errorf("failed to release outbox event %d: %w", id, err)
+	}
+	return nil
+}
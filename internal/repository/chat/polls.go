@@ -0,0 +1,154 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrPollNotFound = errors.New("poll not found")
+	ErrPollClosed   = errors.New("poll is closed")
+)
+
+type NewPoll struct {
+	Question       string
+	Options        []string
+	MultipleChoice bool
+	Anonymous      bool
+	ClosesAt       *time.Time
+}
+
+func insertPoll(ctx context.Context, tx pgx.Tx, messageID string, poll NewPoll) error {
+	query := `
+		INSERT INTO polls (message_id, question, options, multiple_choice, anonymous, closes_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := tx.Exec(ctx, query, messageID, poll.Question, poll.Options, poll.MultipleChoice, poll.Anonymous, poll.ClosesAt)
+	if err != nil {
+		return fmt.Errorf("failed to create poll: %w", err)
+	}
+	return nil
+}
+
+// GetPolls loads the polls among the given messages of a chat, with their
+// tallies. Messages without a poll are left out of the result.
+func (r *postgresRepository) GetPolls(ctx context.Context, chatID string, messageIDs []string, viewerID int64) (map[string]*models.Poll, error) {
+	pollsQuery := `
+		SELECT p.message_id, p.question, p.options, p.multiple_choice, p.anonymous, p.closes_at,
+		       p.closes_at IS NOT NULL AND p.closes_at <= NOW(),
+		       (SELECT COUNT(DISTINCT v.user_id) FROM poll_votes v WHERE v.message_id = p.message_id)
+		FROM polls p
+		JOIN messages m ON m.id = p.message_id
+		WHERE m.chat_id = $1 AND p.message_id = ANY($2::uuid[]) AND ` + notExpired + `
+	`
+	rows, err := r.db.Query(ctx, pollsQuery, chatID, messageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query polls: %w", err)
+	}
+	defer rows.Close()
+
+	polls := make(map[string]*models.Poll)
+	var pollIDs []string
+	for rows.Next() {
+		var id string
+		var options []string
+		poll := &models.Poll{}
+		err := rows.Scan(&id, &poll.Question, &options, &poll.MultipleChoice, &poll.Anonymous, &poll.ClosesAt, &poll.Closed, &poll.TotalVoters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan poll row: %w", err)
+		}
+		poll.Options = make([]models.PollOption, len(options))
+		for i, text := range options {
+			poll.Options[i].Text = text
+		}
+		polls[id] = poll
+		pollIDs = append(pollIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating poll rows: %w", err)
+	}
+	if len(pollIDs) == 0 {
+		return polls, nil
+	}
+
+	tallyQuery := `
+		SELECT v.message_id, v.option_index, COUNT(*),
+		       CASE WHEN p.anonymous THEN NULL ELSE array_agg(v.user_id ORDER BY v.voted_at, v.user_id) END,
+		       bool_or(v.user_id = $2)
+		FROM poll_votes v
+		JOIN polls p ON p.message_id = v.message_id
+		WHERE v.message_id = ANY($1::uuid[])
+		GROUP BY v.message_id, v.option_index, p.anonymous
+	`
+	rows, err = r.db.Query(ctx, tallyQuery, pollIDs, viewerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query poll votes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var index int
+		var option models.PollOption
+		if err := rows.Scan(&id, &index, &option.Votes, &option.Voters, &option.Chosen); err != nil {
+			return nil, fmt.Errorf("failed to scan poll vote row: %w", err)
+		}
+		poll := polls[id]
+		if index < 0 || index >= len(poll.Options) {
+			continue
+		}
+		option.Text = poll.Options[index].Text
+		poll.Options[index] = option
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating poll vote rows: %w", err)
+	}
+
+	return polls, nil
+}
+
+// SetPollVotes replaces the user's choices in a poll; no options retracts
+// the vote. Closed polls are rejected with ErrPollClosed.
+func (r *postgresRepository) SetPollVotes(ctx context.Context, messageID string, userID int64, options []int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var open bool
+	lockQuery := "SELECT closes_at IS NULL OR closes_at > NOW() FROM polls WHERE message_id = $1 FOR SHARE"
+	if err := tx.QueryRow(ctx, lockQuery, messageID).Scan(&open); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrPollNotFound
+		}
+		return fmt.Errorf("failed to lock poll: %w", err)
+	}
+	if !open {
+		return ErrPollClosed
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM poll_votes WHERE message_id = $1 AND user_id = $2", messageID, userID); err != nil {
+		return fmt.Errorf("failed to clear poll votes: %w", err)
+	}
+
+	if len(options) > 0 {
+		insertQuery := `
+			INSERT INTO poll_votes (message_id, option_index, user_id)
+			SELECT $1::uuid, unnest($2::smallint[]), $3::bigint
+		`
+		if _, err := tx.Exec(ctx, insertQuery, messageID, options, userID); err != nil {
+			return fmt.Errorf("failed to store poll votes: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
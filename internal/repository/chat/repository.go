@@ -3,36 +3,204 @@ package chat
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/christmas-fire/nexus/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var (
+	ErrMessageNotFound = errors.New("message not found")
+)
+
+// invalidTextRepresentation is raised for a message id that is not a UUID.
+const invalidTextRepresentation = "22P02"
+
+const (
+	RoleMember = "member"
+	RoleAdmin  = "admin"
+)
+
 type ChatRepository interface {
-	CreateChat(ctx context.Context, name *string, memberIDs []int64) (string, error)
+	CreateChat(ctx context.Context, name *string, creatorID int64, memberIDs []int64) (string, error)
 	IsMember(ctx context.Context, chatID string, userID int64) (bool, error)
-	SendMessage(ctx context.Context, chatID string, senderID int64, text string) (messageID string, sentAt time.Time, err error)
+	IsAdmin(ctx context.Context, chatID string, userID int64) (bool, error)
+	SendMessage(ctx context.Context, msg NewMessage) (SentMessage, error)
+	SendMessages(ctx context.Context, msgs []NewMessage) ([]SentMessage, error)
+	GetForwardSources(ctx context.Context, chatID string, messageIDs []string) ([]ForwardSource, error)
+	GetMessage(ctx context.Context, chatID, messageID string) (models.Message, error)
+	GetMessageByClientID(ctx context.Context, senderID int64, clientMessageID string) (models.Message, error)
 	GetHistory(ctx context.Context, chatID string, limit int) ([]models.Message, error)
 	GetChatMemberIDs(ctx context.Context, chatID string) ([]int64, error)
-	GetChatsByUserID(ctx context.Context, userID int64) ([]ChatInfo, error)
+	GetChatsByUserID(ctx context.Context, userID int64, includeArchived bool, after *MessageCursor, limit int) ([]ChatInfo, error)
+	SearchMessages(ctx context.Context, userID int64, filter SearchFilter) ([]SearchResult, error)
+	PinMessage(ctx context.Context, chatID, messageID string, pinnedBy int64) (time.Time, error)
+	UnpinMessage(ctx context.Context, chatID, messageID string) error
+	GetPinnedMessages(ctx context.Context, chatID string) ([]PinnedMessage, error)
+	FindMembersByUsernames(ctx context.Context, chatID string, usernames []string) (map[string][]int64, error)
+	GetMentions(ctx context.Context, userID int64, unreadOnly bool, after *MessageCursor, limit int) ([]MentionedMessage, error)
+	MarkMentionsRead(ctx context.Context, userID int64, chatID string) error
+	SetLinkPreview(ctx context.Context, chatID, messageID string, preview models.LinkPreview) error
+	SetMessageTTL(ctx context.Context, chatID string, ttl time.Duration) error
+	DeleteExpiredMessages(ctx context.Context, limit int) ([]ExpiredMessage, error)
+	DeleteMessage(ctx context.Context, chatID, messageID string) error
+	GetPolls(ctx context.Context, chatID string, messageIDs []string, viewerID int64) (map[string]*models.Poll, error)
+	SetPollVotes(ctx context.Context, messageID string, userID int64, options []int) error
+	SaveDraft(ctx context.Context, userID int64, draft models.Draft) (time.Time, error)
+	GetDrafts(ctx context.Context, userID int64) ([]models.Draft, error)
+	UpdateChatSettings(ctx context.Context, chatID string, userID int64, update ChatSettingsUpdate) (models.ChatSettings, error)
+	CountPinnedChats(ctx context.Context, userID int64, exceptChatID string) (int, error)
+	IsBlocked(ctx context.Context, blockerID, blockedID int64) (bool, error)
+	IsBlockedInDirectChat(ctx context.Context, chatID string, senderID int64) (bool, error)
+	GetBlockerIDs(ctx context.Context, userID int64) ([]int64, error)
+	CreateScheduledMessage(ctx context.Context, msg ScheduledMessage) (ScheduledMessage, error)
+	CountPendingScheduled(ctx context.Context, senderID int64) (int, error)
+	ListScheduledMessages(ctx context.Context, senderID int64, chatID *string) ([]ScheduledMessage, error)
+	UpdateScheduledMessage(ctx context.Context, msg ScheduledMessage) (ScheduledMessage, error)
+	CancelScheduledMessage(ctx context.Context, id string, senderID int64) error
+	DeliverDueScheduled(ctx context.Context, limit int, deliver DeliverFunc) (int, error)
+	RelayOutbox(ctx context.Context, limit int, relay RelayFunc) (int, error)
+}
+
+// messageColumns selects a models.Message from "messages m" joined with
+// pinnedJoin; scan it with messageDest.
+const messageColumns = "m.id, m.chat_id, m.sender_id, m.text, m.sent_at, pm.message_id IS NOT NULL, m.mentions, m.entities, m.link_preview, m.forwarded_from, m.expires_at"
+
+const pinnedJoin = "LEFT JOIN pinned_messages pm ON pm.chat_id = m.chat_id AND pm.message_id = m.id"
+
+// notExpired hides messages past their expiry that the reaper has not
+// deleted yet.
+const notExpired = "(m.expires_at IS NULL OR m.expires_at > NOW())"
+
+func messageDest(msg *models.Message) []any {
+	return []any{&msg.ID, &msg.ChatID, &msg.SenderID, &msg.Text, &msg.SentAt, &msg.Pinned, &msg.Mentions, &msg.Entities, &msg.LinkPreview, &msg.ForwardedFrom, &msg.ExpiresAt}
 }
 
 type postgresRepository struct {
-	db *pgxpool.Pool
+	db           *pgxpool.Pool
+	searchConfig string
 }
 
-func NewPostgresRepository(db *pgxpool.Pool) ChatRepository {
-	return &postgresRepository{db: db}
+// NewPostgresRepository creates a chat repository. searchConfig is the
+// Postgres text search configuration (e.g. "simple", "english", "russian")
+// used both to index new messages and to parse search queries.
+func NewPostgresRepository(db *pgxpool.Pool, searchConfig string) ChatRepository {
+	if searchConfig == "" {
+		searchConfig = "simple"
+	}
+	return &postgresRepository{db: db, searchConfig: searchConfig}
 }
 
 type ChatInfo struct {
-	ID   string
-	Name string
+	ID             string
+	Name           string
+	UnreadMentions int
+	MessageTTL     time.Duration
+	Draft          *models.Draft
+	Settings       models.ChatSettings
+	// LastActivityAt is when the last message was sent, or when the chat
+	// was created if it has none.
+	LastActivityAt time.Time
+	LastMessage    *MessagePreview
+}
+
+// MessagePreview is the shortened last message shown in the chat list.
+type MessagePreview struct {
+	ID       string
+	SenderID int64
+	Snippet  string
+	SentAt   time.Time
+}
+
+type NewMessage struct {
+	ChatID   string
+	SenderID int64
+	Text     string
+	Mentions []models.Mention
+	Entities []models.Entity
+	// ClientMessageID, when set, makes the insert idempotent per sender.
+	ClientMessageID *string
+
+	LinkPreview   *models.LinkPreview
+	ForwardedFrom *models.ForwardedFrom
+	// Poll makes the message a poll; Text then carries its question.
+	Poll *NewPoll
+	// Events, when set, builds the events announcing the message, which
+	// are written to the outbox along with it.
+	Events EventsFunc
+}
+
+type SentMessage struct {
+	ID     string
+	SentAt time.Time
+	// ExpiresAt is set when the chat has a message TTL.
+	ExpiresAt *time.Time
+	// MentionedUserIDs lists the members who got an inbox entry for the message.
+	MentionedUserIDs []int64
+	// Duplicate reports that a message with the same client message id was
+	// already stored; ID, SentAt and DuplicateChatID describe that message.
+	Duplicate bool
+	// DuplicateChatID is the chat the duplicate was stored in, which need
+	// not be the chat the new message was meant for.
+	DuplicateChatID string
 }
 
-func (r *postgresRepository) CreateChat(ctx context.Context, name *string, memberIDs []int64) (string, error) {
+type ForwardSource struct {
+	Message models.Message
+	// SenderHidden reports the sender's privacy choice to not be named
+	// on forwarded copies of their messages.
+	SenderHidden bool
+}
+
+type ExpiredMessage struct {
+	ChatID string
+	ID     string
+}
+
+type MentionedMessage struct {
+	Message models.Message
+	Read    bool
+}
+
+type PinnedMessage struct {
+	Message  models.Message
+	PinnedBy int64
+	PinnedAt time.Time
+}
+
+type MessageCursor struct {
+	SentAt time.Time
+	ID     string
+}
+
+type SearchFilter struct {
+	Query    string
+	ChatID   *string
+	SenderID *int64
+	From     *time.Time
+	To       *time.Time
+	After    *MessageCursor
+	Limit    int
+}
+
+// Highlight is a matched fragment of a snippet, in runes.
+type Highlight struct {
+	Offset int
+	Length int
+}
+
+type SearchResult struct {
+	Message    models.Message
+	Snippet    string
+	Highlights []Highlight
+}
+
+func (r *postgresRepository) CreateChat(ctx context.Context, name *string, creatorID int64, memberIDs []int64) (string, error) {
 	tx, err := r.db.Begin(ctx)
 	if err != nil {
 		return "", fmt.Errorf("failed to begin transaction: %w", err)
@@ -46,9 +214,13 @@ func (r *postgresRepository) CreateChat(ctx context.Context, name *string, membe
 		return "", fmt.Errorf("failed to create chat: %w", err)
 	}
 
-	addMembersQuery := "INSERT INTO chat_members (chat_id, user_id) VALUES ($1, $2)"
+	addMembersQuery := "INSERT INTO chat_members (chat_id, user_id, role) VALUES ($1, $2, $3)"
 	for _, memberID := range memberIDs {
-		_, err = tx.Exec(ctx, addMembersQuery, chatID, memberID)
+		role := RoleMember
+		if memberID == creatorID {
+			role = RoleAdmin
+		}
+		_, err = tx.Exec(ctx, addMembersQuery, chatID, memberID, role)
 		if err != nil {
 			return "", fmt.Errorf("failed to add member %d to chat: %w", memberID, err)
 		}
@@ -71,23 +243,237 @@ func (r *postgresRepository) IsMember(ctx context.Context, chatID string, userID
 	return isMember, nil
 }
 
-func (r *postgresRepository) SendMessage(ctx context.Context, chatID string, senderID int64, text string) (string, time.Time, error) {
-	query := "INSERT INTO messages (chat_id, sender_id, text) VALUES ($1, $2, $3) RETURNING id, sent_at"
-	var messageID string
-	var sentAt time.Time
-	err := r.db.QueryRow(ctx, query, chatID, senderID, text).Scan(&messageID, &sentAt)
+func (r *postgresRepository) IsAdmin(ctx context.Context, chatID string, userID int64) (bool, error) {
+	query := "SELECT EXISTS(SELECT 1 FROM chat_members WHERE chat_id = $1 AND user_id = $2 AND role = $3)"
+	var isAdmin bool
+	err := r.db.QueryRow(ctx, query, chatID, userID, RoleAdmin).Scan(&isAdmin)
 	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to send message: %w", err)
+		return false, fmt.Errorf("failed to check chat admin role: %w", err)
 	}
-	return messageID, sentAt, nil
+	return isAdmin, nil
+}
+
+// errDuplicateClientMessageID aborts an insert whose client message id the
+// sender has already used.
+var errDuplicateClientMessageID = errors.New("duplicate client message id")
+
+func (r *postgresRepository) SendMessage(ctx context.Context, msg NewMessage) (SentMessage, error) {
+	sent, err := r.SendMessages(ctx, []NewMessage{msg})
+	if errors.Is(err, errDuplicateClientMessageID) {
+		existing, err := r.GetMessageByClientID(ctx, msg.SenderID, *msg.ClientMessageID)
+		if err != nil {
+			return SentMessage{}, err
+		}
+		return SentMessage{
+			ID:              existing.ID,
+			SentAt:          existing.SentAt,
+			ExpiresAt:       existing.ExpiresAt,
+			Duplicate:       true,
+			DuplicateChatID: existing.ChatID,
+		}, nil
+	}
+	if err != nil {
+		return SentMessage{}, err
+	}
+	return sent[0], nil
+}
+
+// SendMessages stores several messages atomically, in order.
+func (r *postgresRepository) SendMessages(ctx context.Context, msgs []NewMessage) ([]SentMessage, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sent := make([]SentMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		s, err := r.insertMessage(ctx, tx, msg)
+		if err != nil {
+			return nil, err
+		}
+		sent = append(sent, s)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return sent, nil
+}
+
+func (r *postgresRepository) insertMessage(ctx context.Context, tx pgx.Tx, msg NewMessage) (SentMessage, error) {
+	mentions := msg.Mentions
+	if mentions == nil {
+		mentions = []models.Mention{}
+	}
+	entities := msg.Entities
+	if entities == nil {
+		entities = []models.Entity{}
+	}
+
+	var mentionedIDs []int64
+	mentionAll := false
+	for _, m := range mentions {
+		if m.All {
+			mentionAll = true
+		} else {
+			mentionedIDs = append(mentionedIDs, m.UserID)
+		}
+	}
+
+	var sent SentMessage
+	insertMessageQuery := `
+		INSERT INTO messages (chat_id, sender_id, text, search_config, mentions, entities, link_preview, forwarded_from, expires_at, client_message_id)
+		VALUES ($1, $2, $3, $4::regconfig, $5, $6, $7, $8,
+			(SELECT NOW() + make_interval(secs => message_ttl_seconds) FROM chats WHERE id = $1 AND message_ttl_seconds > 0),
+			$9)
+		ON CONFLICT (sender_id, client_message_id) WHERE client_message_id IS NOT NULL DO NOTHING
+		RETURNING id, sent_at, expires_at
+	`
+	err := tx.QueryRow(ctx, insertMessageQuery,
+		msg.ChatID, msg.SenderID, msg.Text, r.searchConfig, mentions, entities, msg.LinkPreview, msg.ForwardedFrom, msg.ClientMessageID,
+	).Scan(&sent.ID, &sent.SentAt, &sent.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) && msg.ClientMessageID != nil {
+			return SentMessage{}, errDuplicateClientMessageID
+		}
+		return SentMessage{}, fmt.Errorf("failed to send message: %w", err)
+	}
+
+	if msg.Poll != nil {
+		if err := insertPoll(ctx, tx, sent.ID, *msg.Poll); err != nil {
+			return SentMessage{}, err
+		}
+	}
+
+	lastMessageQuery := `
+		UPDATE chats SET last_message_id = $2, last_message_at = $3
+		WHERE id = $1 AND last_message_at <= $3
+	`
+	if _, err := tx.Exec(ctx, lastMessageQuery, msg.ChatID, sent.ID, sent.SentAt); err != nil {
+		return SentMessage{}, fmt.Errorf("failed to update last message: %w", err)
+	}
+
+	if mentionAll || len(mentionedIDs) > 0 {
+		insertMentionsQuery := `
+			INSERT INTO mentions (user_id, message_id, chat_id, sent_at)
+			SELECT user_id, $2::uuid, chat_id, $4::timestamptz FROM chat_members
+			WHERE chat_id = $1 AND user_id <> $3 AND ($5 OR user_id = ANY($6))
+			  AND NOT EXISTS(SELECT 1 FROM user_blocks WHERE blocker_id = chat_members.user_id AND blocked_id = $3)
+			ON CONFLICT DO NOTHING
+			RETURNING user_id
+		`
+		rows, err := tx.Query(ctx, insertMentionsQuery, msg.ChatID, sent.ID, msg.SenderID, sent.SentAt, mentionAll, mentionedIDs)
+		if err != nil {
+			return SentMessage{}, fmt.Errorf("failed to store mentions: %w", err)
+		}
+		sent.MentionedUserIDs, err = pgx.CollectRows(rows, pgx.RowTo[int64])
+		if err != nil {
+			return SentMessage{}, fmt.Errorf("failed to store mentions: %w", err)
+		}
+	}
+
+	if msg.Events != nil {
+		events, err := msg.Events(sent)
+		if err != nil {
+			return SentMessage{}, err
+		}
+		if err := insertOutboxEvents(ctx, tx, events); err != nil {
+			return SentMessage{}, err
+		}
+	}
+
+	return sent, nil
+}
+
+func (r *postgresRepository) GetForwardSources(ctx context.Context, chatID string, messageIDs []string) ([]ForwardSource, error) {
+	query := `
+		SELECT ` + messageColumns + `, u.hide_forward_sender
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		` + pinnedJoin + `
+		WHERE m.chat_id = $1 AND m.id = ANY($2::uuid[]) AND ` + notExpired + `
+		ORDER BY m.sent_at, m.id
+	`
+	rows, err := r.db.Query(ctx, query, chatID, messageIDs)
+	if err != nil {
+		if isInvalidText(err) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("failed to query messages to forward: %w", err)
+	}
+	defer rows.Close()
+
+	var sources []ForwardSource
+	for rows.Next() {
+		var src ForwardSource
+		if err := rows.Scan(append(messageDest(&src.Message), &src.SenderHidden)...); err != nil {
+			return nil, fmt.Errorf("failed to scan message row: %w", err)
+		}
+		sources = append(sources, src)
+	}
+
+	if err := rows.Err(); err != nil {
+		if isInvalidText(err) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("error iterating message rows: %w", err)
+	}
+
+	return sources, nil
+}
+
+func isInvalidText(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == invalidTextRepresentation
+}
+
+func (r *postgresRepository) GetMessage(ctx context.Context, chatID, messageID string) (models.Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages m
+		` + pinnedJoin + `
+		WHERE m.chat_id = $1 AND m.id = $2 AND ` + notExpired + `
+	`
+	var msg models.Message
+	err := r.db.QueryRow(ctx, query, chatID, messageID).Scan(messageDest(&msg)...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Message{}, ErrMessageNotFound
+		}
+		return models.Message{}, fmt.Errorf("failed to get message: %w", err)
+	}
+	return msg, nil
+}
+
+// GetMessageByClientID finds the message a sender stored under their own
+// client message id, including one that has expired but is not reaped yet.
+func (r *postgresRepository) GetMessageByClientID(ctx context.Context, senderID int64, clientMessageID string) (models.Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages m
+		` + pinnedJoin + `
+		WHERE m.sender_id = $1 AND m.client_message_id = $2
+	`
+	var msg models.Message
+	err := r.db.QueryRow(ctx, query, senderID, clientMessageID).Scan(messageDest(&msg)...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Message{}, ErrMessageNotFound
+		}
+		return models.Message{}, fmt.Errorf("failed to get message by client id: %w", err)
+	}
+	return msg, nil
 }
 
 func (r *postgresRepository) GetHistory(ctx context.Context, chatID string, limit int) ([]models.Message, error) {
 	query := `
-		SELECT id, chat_id, sender_id, text, sent_at 
-		FROM messages 
-		WHERE chat_id = $1 
-		ORDER BY sent_at DESC 
+		SELECT ` + messageColumns + `
+		FROM messages m
+		` + pinnedJoin + `
+		WHERE m.chat_id = $1 AND ` + notExpired + `
+		ORDER BY m.sent_at DESC
 		LIMIT $2
 	`
 	rows, err := r.db.Query(ctx, query, chatID, limit)
@@ -99,7 +485,7 @@ func (r *postgresRepository) GetHistory(ctx context.Context, chatID string, limi
 	var messages []models.Message
 	for rows.Next() {
 		var msg models.Message
-		if err := rows.Scan(&msg.ID, &msg.ChatID, &msg.SenderID, &msg.Text, &msg.SentAt); err != nil {
+		if err := rows.Scan(messageDest(&msg)...); err != nil {
 			return nil, fmt.Errorf("failed to scan message row: %w", err)
 		}
 		messages = append(messages, msg)
@@ -135,15 +521,40 @@ func (r *postgresRepository) GetChatMemberIDs(ctx context.Context, chatID string
 	return memberIDs, nil
 }
 
-func (r *postgresRepository) GetChatsByUserID(ctx context.Context, userID int64) ([]ChatInfo, error) {
+// GetChatsByUserID lists the user's chats: pinned ones first in their custom
+// order, then the rest by latest activity. Archived chats are left out
+// unless includeArchived is set. after is the activity time and id of the
+// last chat of the previous page; pinned chats are only on the first page.
+func (r *postgresRepository) GetChatsByUserID(ctx context.Context, userID int64, includeArchived bool, after *MessageCursor, limit int) ([]ChatInfo, error) {
 	query := `
-        SELECT c.id, c.name FROM chats c
+        SELECT c.id, c.name, c.message_ttl_seconds,
+               (SELECT COUNT(*) FROM mentions mn
+                JOIN messages m ON m.id = mn.message_id
+                WHERE mn.user_id = cm.user_id AND mn.chat_id = c.id AND mn.read_at IS NULL
+                  AND ` + notExpired + `),
+               d.text, d.entities, d.updated_at,
+               cm.muted_until, cm.archived, cm.pinned, cm.sort_order,
+               c.last_message_at, lm.id, lm.sender_id, LEFT(lm.text, $6), lm.sent_at
+        FROM chats c
         JOIN chat_members cm ON c.id = cm.chat_id
-        WHERE cm.user_id = $1
-        ORDER BY c.created_at DESC
+        LEFT JOIN drafts d ON d.user_id = cm.user_id AND d.chat_id = c.id
+        LEFT JOIN messages lm ON lm.id = c.last_message_id AND (lm.expires_at IS NULL OR lm.expires_at > NOW())
+        WHERE cm.user_id = $1 AND ($2 OR NOT cm.archived)
+          AND ($3::timestamptz IS NULL OR (NOT cm.pinned AND (c.last_message_at, c.id) < ($3, $4::uuid)))
+        ORDER BY cm.pinned DESC,
+                 CASE WHEN cm.pinned THEN cm.sort_order END,
+                 c.last_message_at DESC, c.id DESC
+        LIMIT $5
     `
 
-	rows, err := r.db.Query(ctx, query, userID)
+	var afterAt *time.Time
+	var afterID *string
+	if after != nil {
+		afterAt = &after.SentAt
+		afterID = &after.ID
+	}
+
+	rows, err := r.db.Query(ctx, query, userID, includeArchived, afterAt, afterID, limit, previewSnippetLength+1)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query chats by userID: %w", err)
 	}
@@ -153,8 +564,19 @@ func (r *postgresRepository) GetChatsByUserID(ctx context.Context, userID int64)
 	for rows.Next() {
 		var chat ChatInfo
 		var name sql.NullString
+		var ttlSeconds int
+		var draftText *string
+		var draftEntities []models.Entity
+		var draftUpdatedAt *time.Time
+		var lastID, lastText *string
+		var lastSenderID *int64
+		var lastSentAt *time.Time
 
-		if err := rows.Scan(&chat.ID, &name); err != nil {
+		settings := &chat.Settings
+		err := rows.Scan(&chat.ID, &name, &ttlSeconds, &chat.UnreadMentions, &draftText, &draftEntities, &draftUpdatedAt,
+			&settings.MutedUntil, &settings.Archived, &settings.Pinned, &settings.SortOrder,
+			&chat.LastActivityAt, &lastID, &lastSenderID, &lastText, &lastSentAt)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan chat row: %w", err)
 		}
 
@@ -163,6 +585,24 @@ func (r *postgresRepository) GetChatsByUserID(ctx context.Context, userID int64)
 		} else {
 			chat.Name = "Unnamed Chat"
 		}
+		chat.MessageTTL = time.Duration(ttlSeconds) * time.Second
+		settings.ChatID = chat.ID
+		if draftText != nil {
+			chat.Draft = &models.Draft{
+				ChatID:    chat.ID,
+				Text:      *draftText,
+				Entities:  draftEntities,
+				UpdatedAt: *draftUpdatedAt,
+			}
+		}
+		if lastID != nil {
+			chat.LastMessage = &MessagePreview{
+				ID:       *lastID,
+				SenderID: *lastSenderID,
+				Snippet:  previewSnippet(*lastText),
+				SentAt:   *lastSentAt,
+			}
+		}
 
 		chats = append(chats, chat)
 	}
@@ -173,3 +613,362 @@ func (r *postgresRepository) GetChatsByUserID(ctx context.Context, userID int64)
 
 	return chats, nil
 }
+
+const previewSnippetLength = 100
+
+// previewSnippet flattens text to one line and cuts it to
+// previewSnippetLength runes.
+func previewSnippet(text string) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) > previewSnippetLength {
+		return string(runes[:previewSnippetLength-1]) + "…"
+	}
+	return string(runes)
+}
+
+func (r *postgresRepository) PinMessage(ctx context.Context, chatID, messageID string, pinnedBy int64) (time.Time, error) {
+	query := `
+		INSERT INTO pinned_messages (chat_id, message_id, pinned_by)
+		SELECT chat_id, id, $3::bigint FROM messages m WHERE chat_id = $1 AND id = $2 AND ` + notExpired + `
+		ON CONFLICT (chat_id, message_id) DO UPDATE
+		SET pinned_by = EXCLUDED.pinned_by, pinned_at = NOW()
+		RETURNING pinned_at
+	`
+	var pinnedAt time.Time
+	err := r.db.QueryRow(ctx, query, chatID, messageID, pinnedBy).Scan(&pinnedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, ErrMessageNotFound
+		}
+		return time.Time{}, fmt.Errorf("failed to pin message: %w", err)
+	}
+	return pinnedAt, nil
+}
+
+func (r *postgresRepository) UnpinMessage(ctx context.Context, chatID, messageID string) error {
+	query := "DELETE FROM pinned_messages WHERE chat_id = $1 AND message_id = $2"
+	tag, err := r.db.Exec(ctx, query, chatID, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to unpin message: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+func (r *postgresRepository) GetPinnedMessages(ctx context.Context, chatID string) ([]PinnedMessage, error) {
+	query := `
+		SELECT ` + messageColumns + `, pm.pinned_by, pm.pinned_at
+		FROM pinned_messages pm
+		JOIN messages m ON m.id = pm.message_id
+		WHERE pm.chat_id = $1 AND ` + notExpired + `
+		ORDER BY pm.pinned_at DESC
+	`
+	rows, err := r.db.Query(ctx, query, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pinned messages: %w", err)
+	}
+	defer rows.Close()
+
+	var pinned []PinnedMessage
+	for rows.Next() {
+		var pm PinnedMessage
+		dest := append(messageDest(&pm.Message), &pm.PinnedBy, &pm.PinnedAt)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan pinned message row: %w", err)
+		}
+		pinned = append(pinned, pm)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pinned message rows: %w", err)
+	}
+
+	return pinned, nil
+}
+
+func (r *postgresRepository) FindMembersByUsernames(ctx context.Context, chatID string, usernames []string) (map[string][]int64, error) {
+	query := `
+		SELECT cm.user_id, LOWER(u.username) FROM chat_members cm
+		JOIN users u ON u.id = cm.user_id
+		WHERE cm.chat_id = $1 AND LOWER(u.username) = ANY($2)
+	`
+	rows, err := r.db.Query(ctx, query, chatID, usernames)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query members by username: %w", err)
+	}
+	defer rows.Close()
+
+	members := make(map[string][]int64)
+	for rows.Next() {
+		var id int64
+		var username string
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, fmt.Errorf("failed to scan member row: %w", err)
+		}
+		members[username] = append(members[username], id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating member rows: %w", err)
+	}
+
+	return members, nil
+}
+
+func (r *postgresRepository) GetMentions(ctx context.Context, userID int64, unreadOnly bool, after *MessageCursor, limit int) ([]MentionedMessage, error) {
+	query := `
+		SELECT ` + messageColumns + `, mn.read_at IS NOT NULL
+		FROM mentions mn
+		JOIN messages m ON m.id = mn.message_id
+		` + pinnedJoin + `
+		WHERE mn.user_id = $1 AND ` + notExpired + `
+		  AND (NOT $2 OR mn.read_at IS NULL)
+		  AND ($3::timestamptz IS NULL OR (mn.sent_at, mn.message_id) < ($3, $4::uuid))
+		ORDER BY mn.sent_at DESC, mn.message_id DESC
+		LIMIT $5
+	`
+
+	var afterSentAt *time.Time
+	var afterID *string
+	if after != nil {
+		afterSentAt = &after.SentAt
+		afterID = &after.ID
+	}
+
+	rows, err := r.db.Query(ctx, query, userID, unreadOnly, afterSentAt, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query mentions: %w", err)
+	}
+	defer rows.Close()
+
+	var mentioned []MentionedMessage
+	for rows.Next() {
+		var mm MentionedMessage
+		if err := rows.Scan(append(messageDest(&mm.Message), &mm.Read)...); err != nil {
+			return nil, fmt.Errorf("failed to scan mention row: %w", err)
+		}
+		mentioned = append(mentioned, mm)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating mention rows: %w", err)
+	}
+
+	return mentioned, nil
+}
+
+func (r *postgresRepository) MarkMentionsRead(ctx context.Context, userID int64, chatID string) error {
+	query := "UPDATE mentions SET read_at = NOW() WHERE user_id = $1 AND chat_id = $2 AND read_at IS NULL"
+	if _, err := r.db.Exec(ctx, query, userID, chatID); err != nil {
+		return fmt.Errorf("failed to mark mentions read: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) SetLinkPreview(ctx context.Context, chatID, messageID string, preview models.LinkPreview) error {
+	query := "UPDATE messages SET link_preview = $3 WHERE chat_id = $1 AND id = $2"
+	tag, err := r.db.Exec(ctx, query, chatID, messageID, preview)
+	if err != nil {
+		return fmt.Errorf("failed to set link preview: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+// SetMessageTTL changes the lifetime of messages sent to the chat from now
+// on. Messages already sent keep their expiry. A zero ttl turns it off.
+func (r *postgresRepository) SetMessageTTL(ctx context.Context, chatID string, ttl time.Duration) error {
+	query := "UPDATE chats SET message_ttl_seconds = $2 WHERE id = $1"
+	tag, err := r.db.Exec(ctx, query, chatID, int(ttl/time.Second))
+	if err != nil {
+		return fmt.Errorf("failed to set message ttl: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to set message ttl: chat %s not found", chatID)
+	}
+	return nil
+}
+
+// refreshLastMessageQuery points chats in $1 whose preview message was
+// deleted at their newest remaining message.
+const refreshLastMessageQuery = `
+	UPDATE chats c SET last_message_id = (
+		SELECT m.id FROM messages m WHERE m.chat_id = c.id
+		ORDER BY m.sent_at DESC, m.id DESC
+		LIMIT 1
+	)
+	WHERE c.id = ANY($1::uuid[]) AND c.last_message_id IS NULL
+`
+
+// DeleteExpiredMessages hard-deletes up to limit expired messages, oldest
+// expiry first. Concurrent callers skip each other's rows. Chats that lose
+// their last message get the newest remaining one as their preview.
+func (r *postgresRepository) DeleteExpiredMessages(ctx context.Context, limit int) ([]ExpiredMessage, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		DELETE FROM messages
+		WHERE id IN (
+			SELECT id FROM messages
+			WHERE expires_at <= NOW()
+			ORDER BY expires_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING chat_id, id
+	`
+	rows, err := tx.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired messages: %w", err)
+	}
+
+	var expired []ExpiredMessage
+	var chatIDs []string
+	for rows.Next() {
+		var msg ExpiredMessage
+		if err := rows.Scan(&msg.ChatID, &msg.ID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan expired message row: %w", err)
+		}
+		expired = append(expired, msg)
+		chatIDs = append(chatIDs, msg.ChatID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating expired message rows: %w", err)
+	}
+
+	if len(expired) > 0 {
+		if _, err := tx.Exec(ctx, refreshLastMessageQuery, chatIDs); err != nil {
+			return nil, fmt.Errorf("failed to refresh last messages: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return expired, nil
+}
+
+// DeleteMessage hard-deletes a single message and refreshes the chat's
+// last message preview.
+func (r *postgresRepository) DeleteMessage(ctx context.Context, chatID, messageID string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "DELETE FROM messages WHERE chat_id = $1 AND id = $2", chatID, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMessageNotFound
+	}
+
+	if _, err := tx.Exec(ctx, refreshLastMessageQuery, []string{chatID}); err != nil {
+		return fmt.Errorf("failed to refresh last message: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// The selection markers are private-use characters. Any already in the
+// message text are removed before ts_headline runs, so that every marker in
+// a headline is one it placed.
+const (
+	headlineStartSel = "\ue000"
+	headlineStopSel  = "\ue001"
+	headlineMarkers  = headlineStartSel + headlineStopSel
+	headlineOptions  = "StartSel=" + headlineStartSel + ", StopSel=" + headlineStopSel +
+		", MaxWords=24, MinWords=8, MaxFragments=2, FragmentDelimiter=\" … \""
+)
+
+func (r *postgresRepository) SearchMessages(ctx context.Context, userID int64, filter SearchFilter) ([]SearchResult, error) {
+	query := `
+		SELECT ` + messageColumns + `, ts_headline(m.search_config, translate(m.text, $12, ''), q.query, $3)
+		FROM messages m
+		JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = $1
+		` + pinnedJoin + `
+		CROSS JOIN websearch_to_tsquery($2::regconfig, $4) AS q(query)
+		WHERE m.search_vector @@ q.query AND ` + notExpired + `
+		  AND ($5::uuid IS NULL OR m.chat_id = $5::uuid)
+		  AND ($6::bigint IS NULL OR m.sender_id = $6)
+		  AND ($7::timestamptz IS NULL OR m.sent_at >= $7)
+		  AND ($8::timestamptz IS NULL OR m.sent_at < $8)
+		  AND ($9::timestamptz IS NULL OR (m.sent_at, m.id) < ($9, $10::uuid))
+		ORDER BY m.sent_at DESC, m.id DESC
+		LIMIT $11
+	`
+
+	var afterSentAt *time.Time
+	var afterID *string
+	if filter.After != nil {
+		afterSentAt = &filter.After.SentAt
+		afterID = &filter.After.ID
+	}
+
+	rows, err := r.db.Query(ctx, query,
+		userID, r.searchConfig, headlineOptions, filter.Query,
+		filter.ChatID, filter.SenderID, filter.From, filter.To,
+		afterSentAt, afterID, filter.Limit, headlineMarkers,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var res SearchResult
+		var headline string
+		if err := rows.Scan(append(messageDest(&res.Message), &headline)...); err != nil {
+			return nil, fmt.Errorf("failed to scan search row: %w", err)
+		}
+		res.Snippet, res.Highlights = parseHeadline(headline)
+		results = append(results, res)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating search rows: %w", err)
+	}
+
+	return results, nil
+}
+
+// parseHeadline strips the ts_headline selection markers and returns the
+// plain snippet together with the positions of the highlighted fragments.
+func parseHeadline(headline string) (string, []Highlight) {
+	var sb strings.Builder
+	var highlights []Highlight
+	pos, start := 0, -1
+	for _, r := range headline {
+		switch string(r) {
+		case headlineStartSel:
+			start = pos
+		case headlineStopSel:
+			if start >= 0 && pos > start {
+				highlights = append(highlights, Highlight{Offset: start, Length: pos - start})
+			}
+			start = -1
+		default:
+			sb.WriteRune(r)
+			pos++
+		}
+	}
+	return sb.String(), highlights
+}
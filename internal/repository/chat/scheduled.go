@@ -0,0 +1,242 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrScheduledMessageNotFound = errors.New("scheduled message not found")
+	// ErrRetryDelivery marks a delivery failure as transient: the message is
+	// left pending and picked up again on the next run.
+	ErrRetryDelivery = errors.New("scheduled message delivery should be retried")
+)
+
+const (
+	ScheduledPending   = "pending"
+	ScheduledSending   = "sending"
+	ScheduledSent      = "sent"
+	ScheduledFailed    = "failed"
+	ScheduledCancelled = "cancelled"
+)
+
+const (
+	// scheduledLease is how long a scheduler has to deliver the messages it
+	// claimed before they may be claimed again.
+	scheduledLease = time.Minute
+	// maxScheduledBackoffSeconds caps the wait before a message whose
+	// delivery keeps failing is tried again.
+	maxScheduledBackoffSeconds = 300
+	// maxScheduledAttempts is how often delivery is tried before the
+	// message is marked as failed.
+	maxScheduledAttempts = 10
+)
+
+type ScheduledMessage struct {
+	ID        string
+	ChatID    string
+	SenderID  int64
+	Text      string
+	Entities  []models.Entity
+	SendAt    time.Time
+	CreatedAt time.Time
+}
+
+// DeliverFunc sends a due scheduled message and returns the id of the
+// stored chat message. Errors other than ErrRetryDelivery mark the message
+// as failed.
+type DeliverFunc func(ctx context.Context, msg ScheduledMessage) (string, error)
+
+const scheduledColumns = "id, chat_id, sender_id, text, entities, send_at, created_at"
+
+func scheduledDest(msg *ScheduledMessage) []any {
+	return []any{&msg.ID, &msg.ChatID, &msg.SenderID, &msg.Text, &msg.Entities, &msg.SendAt, &msg.CreatedAt}
+}
+
+func (r *postgresRepository) CreateScheduledMessage(ctx context.Context, msg ScheduledMessage) (ScheduledMessage, error) {
+	query := `
+		INSERT INTO scheduled_messages (chat_id, sender_id, text, entities, send_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + scheduledColumns
+
+	entities := msg.Entities
+	if entities == nil {
+		entities = []models.Entity{}
+	}
+
+	var created ScheduledMessage
+	err := r.db.QueryRow(ctx, query, msg.ChatID, msg.SenderID, msg.Text, entities, msg.SendAt).Scan(scheduledDest(&created)...)
+	if err != nil {
+		return ScheduledMessage{}, fmt.Errorf("failed to create scheduled message: %w", err)
+	}
+	return created, nil
+}
+
+func (r *postgresRepository) CountPendingScheduled(ctx context.Context, senderID int64) (int, error) {
+	query := "SELECT COUNT(*) FROM scheduled_messages WHERE sender_id = $1 AND status = $2"
+	var count int
+	if err := r.db.QueryRow(ctx, query, senderID, ScheduledPending).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count scheduled messages: %w", err)
+	}
+	return count, nil
+}
+
+func (r *postgresRepository) ListScheduledMessages(ctx context.Context, senderID int64, chatID *string) ([]ScheduledMessage, error) {
+	query := `
+		SELECT ` + scheduledColumns + `
+		FROM scheduled_messages
+		WHERE sender_id = $1 AND status = $2 AND ($3::uuid IS NULL OR chat_id = $3::uuid)
+		ORDER BY send_at, id
+	`
+	rows, err := r.db.Query(ctx, query, senderID, ScheduledPending, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scheduled messages: %w", err)
+	}
+	defer rows.Close()
+
+	var scheduled []ScheduledMessage
+	for rows.Next() {
+		var msg ScheduledMessage
+		if err := rows.Scan(scheduledDest(&msg)...); err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled message row: %w", err)
+		}
+		scheduled = append(scheduled, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating scheduled message rows: %w", err)
+	}
+
+	return scheduled, nil
+}
+
+// UpdateScheduledMessage edits a pending message owned by msg.SenderID.
+// Messages already claimed by the scheduler are reported as not found.
+func (r *postgresRepository) UpdateScheduledMessage(ctx context.Context, msg ScheduledMessage) (ScheduledMessage, error) {
+	query := `
+		UPDATE scheduled_messages
+		SET text = $3, entities = $4, send_at = $5, updated_at = NOW()
+		WHERE id = $1 AND sender_id = $2 AND status = $6
+		RETURNING ` + scheduledColumns
+
+	entities := msg.Entities
+	if entities == nil {
+		entities = []models.Entity{}
+	}
+
+	var updated ScheduledMessage
+	err := r.db.QueryRow(ctx, query, msg.ID, msg.SenderID, msg.Text, entities, msg.SendAt, ScheduledPending).Scan(scheduledDest(&updated)...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ScheduledMessage{}, ErrScheduledMessageNotFound
+		}
+		return ScheduledMessage{}, fmt.Errorf("failed to update scheduled message: %w", err)
+	}
+	return updated, nil
+}
+
+func (r *postgresRepository) CancelScheduledMessage(ctx context.Context, id string, senderID int64) error {
+	query := `
+		UPDATE scheduled_messages SET status = $3, updated_at = NOW()
+		WHERE id = $1 AND sender_id = $2 AND status = $4
+	`
+	tag, err := r.db.Exec(ctx, query, id, senderID, ScheduledCancelled, ScheduledPending)
+	if err != nil {
+		return fmt.Errorf("failed to cancel scheduled message: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrScheduledMessageNotFound
+	}
+	return nil
+}
+
+// DeliverDueScheduled claims up to limit due messages and hands each one to
+// deliver. It returns how many of them were sent or marked as failed.
+// Claimed messages are marked as sending for scheduledLease, in a
+// transaction of their own, and delivered outside it; messages left sending
+// by a scheduler that died are claimed again once the lease runs out.
+// deliver must therefore be idempotent. Transient failures are retried
+// later, backing off exponentially, so that they do not hold up other due
+// messages.
+func (r *postgresRepository) DeliverDueScheduled(ctx context.Context, limit int, deliver DeliverFunc) (int, error) {
+	claimQuery := `
+		UPDATE scheduled_messages
+		SET status = $1, claimed_until = NOW() + make_interval(secs => $4),
+			attempts = attempts + 1, updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM scheduled_messages
+			WHERE (status = $2 AND send_at <= NOW() AND (retry_at IS NULL OR retry_at <= NOW()))
+				OR (status = $1 AND claimed_until < NOW())
+			ORDER BY send_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + scheduledColumns + `, attempts
+	`
+	rows, err := r.db.Query(ctx, claimQuery, ScheduledSending, ScheduledPending, limit, scheduledLease.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim scheduled messages: %w", err)
+	}
+
+	type claimedMessage struct {
+		msg      ScheduledMessage
+		attempts int
+	}
+	var due []claimedMessage
+	for rows.Next() {
+		var c claimedMessage
+		if err := rows.Scan(append(scheduledDest(&c.msg), &c.attempts)...); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan scheduled message row: %w", err)
+		}
+		due = append(due, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating scheduled message rows: %w", err)
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].msg.SendAt.Before(due[j].msg.SendAt) })
+
+	markSentQuery := `
+		UPDATE scheduled_messages SET status = $2, message_id = $3, claimed_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = $4
+	`
+	markFailedQuery := `
+		UPDATE scheduled_messages SET status = $2, error = $3, claimed_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = $4
+	`
+	retryQuery := `
+		UPDATE scheduled_messages
+		SET status = $2, error = $3, claimed_until = NULL, updated_at = NOW(),
+			retry_at = NOW() + make_interval(secs => LEAST(power(2, attempts), $4))
+		WHERE id = $1 AND status = $5
+	`
+	processed := 0
+	for _, c := range due {
+		messageID, err := deliver(ctx, c.msg)
+		switch {
+		case errors.Is(err, ErrRetryDelivery) && c.attempts < maxScheduledAttempts:
+			_, err = r.db.Exec(ctx, retryQuery, c.msg.ID, ScheduledPending, err.Error(), maxScheduledBackoffSeconds, ScheduledSending)
+			if err != nil {
+				return 0, fmt.Errorf("failed to reschedule scheduled message %s: %w", c.msg.ID, err)
+			}
+			continue
+		case err != nil:
+			_, err = r.db.Exec(ctx, markFailedQuery, c.msg.ID, ScheduledFailed, err.Error(), ScheduledSending)
+		default:
+			_, err = r.db.Exec(ctx, markSentQuery, c.msg.ID, ScheduledSent, messageID, ScheduledSending)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to record scheduled message %s status: %w", c.msg.ID, err)
+		}
+		processed++
+	}
+
+	return processed, nil
+}
@@ -0,0 +1,59 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrNotMember = errors.New("user is not a member of the chat")
+)
+
+// ChatSettingsUpdate changes only the settings that are set. Unmute clears
+// MutedUntil and takes precedence over it.
+type ChatSettingsUpdate struct {
+	MutedUntil *time.Time
+	Unmute     bool
+	Archived   *bool
+	Pinned     *bool
+	SortOrder  *int
+}
+
+func (r *postgresRepository) UpdateChatSettings(ctx context.Context, chatID string, userID int64, update ChatSettingsUpdate) (models.ChatSettings, error) {
+	query := `
+		UPDATE chat_members SET
+			muted_until = CASE WHEN $3 THEN NULL ELSE COALESCE($4, muted_until) END,
+			archived = COALESCE($5, archived),
+			pinned = COALESCE($6, pinned),
+			sort_order = COALESCE($7, sort_order)
+		WHERE chat_id = $1 AND user_id = $2
+		RETURNING chat_id, muted_until, archived, pinned, sort_order
+	`
+	var settings models.ChatSettings
+	err := r.db.QueryRow(ctx, query,
+		chatID, userID, update.Unmute, update.MutedUntil, update.Archived, update.Pinned, update.SortOrder,
+	).Scan(&settings.ChatID, &settings.MutedUntil, &settings.Archived, &settings.Pinned, &settings.SortOrder)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.ChatSettings{}, ErrNotMember
+		}
+		return models.ChatSettings{}, fmt.Errorf("failed to update chat settings: %w", err)
+	}
+	return settings, nil
+}
+
+// CountPinnedChats counts the chats the user has pinned, not counting
+// exceptChatID.
+func (r *postgresRepository) CountPinnedChats(ctx context.Context, userID int64, exceptChatID string) (int, error) {
+	query := "SELECT COUNT(*) FROM chat_members WHERE user_id = $1 AND pinned AND chat_id <> $2"
+	var count int
+	if err := r.db.QueryRow(ctx, query, userID, exceptChatID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count pinned chats: %w", err)
+	}
+	return count, nil
+}
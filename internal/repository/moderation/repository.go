@@ -0,0 +1,311 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrReportNotFound  = errors.New("report not found")
+	ErrAlreadyReported = errors.New("message already reported")
+	ErrReportClosed    = errors.New("report is already closed")
+	ErrUserNotFound    = errors.New("user not found")
+)
+
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+const (
+	ReportOpen      = "open"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+)
+
+const (
+	ActionResolveReport = "resolve_report"
+	ActionDeleteMessage = "delete_message"
+	ActionSuspendUser   = "suspend_user"
+	ActionUnsuspendUser = "unsuspend_user"
+)
+
+type Report struct {
+	ID             string
+	ReporterID     int64
+	ReportedUserID int64
+	ChatID         *string
+	MessageID      *string
+	// MessageText is a copy of the reported message taken when the report
+	// was filed, so the evidence outlives deletion and expiry.
+	MessageText    *string
+	Reason         string
+	Details        string
+	Status         string
+	ResolvedBy     *int64
+	ResolutionNote string
+	CreatedAt      time.Time
+	ResolvedAt     *time.Time
+}
+
+// ReportCursor is the position of the last report on a page.
+type ReportCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Action is an entry in the moderation audit log.
+type Action struct {
+	ModeratorID  int64
+	Action       string
+	TargetUserID *int64
+	MessageID    *string
+	ReportID     *string
+	Note         string
+}
+
+type ModerationRepository interface {
+	CreateReport(ctx context.Context, report Report) (Report, error)
+	GetReport(ctx context.Context, id string) (Report, error)
+	ListReports(ctx context.Context, status string, after *ReportCursor, limit int) ([]Report, error)
+	CloseReport(ctx context.Context, id string, moderatorID int64, status, note string) (Report, error)
+	IsModerator(ctx context.Context, userID int64) (bool, error)
+	IsSuspended(ctx context.Context, userID int64) (bool, error)
+	SuspendUser(ctx context.Context, userID int64, until *time.Time, reason string) error
+	UnsuspendUser(ctx context.Context, userID int64) error
+	LogAction(ctx context.Context, action Action) error
+	LogFilterDecisions(ctx context.Context, decisions []models.FilterDecision) error
+	ListFilterDecisions(ctx context.Context, action string, beforeID int64, limit int) ([]models.FilterDecision, error)
+}
+
+type postgresRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresRepository(db *pgxpool.Pool) ModerationRepository {
+	return &postgresRepository{db: db}
+}
+
+const reportColumns = "id, reporter_id, reported_user_id, chat_id, message_id, message_text, reason, details, status, resolved_by, resolution_note, created_at, resolved_at"
+
+func reportDest(r *Report) []any {
+	return []any{&r.ID, &r.ReporterID, &r.ReportedUserID, &r.ChatID, &r.MessageID, &r.MessageText, &r.Reason, &r.Details, &r.Status, &r.ResolvedBy, &r.ResolutionNote, &r.CreatedAt, &r.ResolvedAt}
+}
+
+func (r *postgresRepository) CreateReport(ctx context.Context, report Report) (Report, error) {
+	query := `
+		INSERT INTO reports (reporter_id, reported_user_id, chat_id, message_id, message_text, reason, details)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING ` + reportColumns
+
+	var created Report
+	err := r.db.QueryRow(ctx, query,
+		report.ReporterID, report.ReportedUserID, report.ChatID, report.MessageID,
+		report.MessageText, report.Reason, report.Details,
+	).Scan(reportDest(&created)...)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case uniqueViolation:
+				return Report{}, ErrAlreadyReported
+			case foreignKeyViolation:
+				return Report{}, ErrUserNotFound
+			}
+		}
+		return Report{}, fmt.Errorf("failed to create report: %w", err)
+	}
+	return created, nil
+}
+
+func (r *postgresRepository) GetReport(ctx context.Context, id string) (Report, error) {
+	query := "SELECT " + reportColumns + " FROM reports WHERE id = $1"
+
+	var report Report
+	if err := r.db.QueryRow(ctx, query, id).Scan(reportDest(&report)...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Report{}, ErrReportNotFound
+		}
+		return Report{}, fmt.Errorf("failed to get report: %w", err)
+	}
+	return report, nil
+}
+
+// ListReports returns reports oldest first, so the queue is worked in the
+// order it was filed. An empty status lists reports in every status.
+func (r *postgresRepository) ListReports(ctx context.Context, status string, after *ReportCursor, limit int) ([]Report, error) {
+	var afterAt *time.Time
+	var afterID *string
+	if after != nil {
+		afterAt, afterID = &after.CreatedAt, &after.ID
+	}
+
+	query := `
+		SELECT ` + reportColumns + `
+		FROM reports
+		WHERE ($1 = '' OR status = $1)
+		  AND ($2::timestamptz IS NULL OR (created_at, id) > ($2, $3::uuid))
+		ORDER BY created_at, id
+		LIMIT $4
+	`
+	rows, err := r.db.Query(ctx, query, status, afterAt, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reports: %w", err)
+	}
+	defer rows.Close()
+
+	var reports []Report
+	for rows.Next() {
+		var report Report
+		if err := rows.Scan(reportDest(&report)...); err != nil {
+			return nil, fmt.Errorf("failed to scan report row: %w", err)
+		}
+		reports = append(reports, report)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating report rows: %w", err)
+	}
+
+	return reports, nil
+}
+
+// CloseReport moves an open report to status, which is ReportResolved or
+// ReportDismissed.
+func (r *postgresRepository) CloseReport(ctx context.Context, id string, moderatorID int64, status, note string) (Report, error) {
+	query := `
+		UPDATE reports
+		SET status = $3, resolved_by = $2, resolution_note = $4, resolved_at = NOW()
+		WHERE id = $1 AND status = 'open'
+		RETURNING ` + reportColumns
+
+	var report Report
+	err := r.db.QueryRow(ctx, query, id, moderatorID, status, note).Scan(reportDest(&report)...)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return Report{}, fmt.Errorf("failed to close report: %w", err)
+		}
+		if _, err := r.GetReport(ctx, id); err != nil {
+			return Report{}, err
+		}
+		return Report{}, ErrReportClosed
+	}
+	return report, nil
+}
+
+func (r *postgresRepository) IsModerator(ctx context.Context, userID int64) (bool, error) {
+	var moderator bool
+	err := r.db.QueryRow(ctx, "SELECT is_moderator FROM users WHERE id = $1", userID).Scan(&moderator)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check moderator: %w", err)
+	}
+	return moderator, nil
+}
+
+func (r *postgresRepository) IsSuspended(ctx context.Context, userID int64) (bool, error) {
+	query := "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND suspended_until > NOW())"
+	var suspended bool
+	if err := r.db.QueryRow(ctx, query, userID).Scan(&suspended); err != nil {
+		return false, fmt.Errorf("failed to check suspension: %w", err)
+	}
+	return suspended, nil
+}
+
+// SuspendUser suspends userID until the given time, or indefinitely when
+// until is nil.
+func (r *postgresRepository) SuspendUser(ctx context.Context, userID int64, until *time.Time, reason string) error {
+	query := `
+		UPDATE users
+		SET suspended_until = COALESCE($2::timestamptz, 'infinity'::timestamptz), suspension_reason = $3
+		WHERE id = $1
+	`
+	tag, err := r.db.Exec(ctx, query, userID, until, reason)
+	if err != nil {
+		return fmt.Errorf("failed to suspend user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *postgresRepository) UnsuspendUser(ctx context.Context, userID int64) error {
+	query := "UPDATE users SET suspended_until = NULL, suspension_reason = '' WHERE id = $1"
+	tag, err := r.db.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to unsuspend user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *postgresRepository) LogAction(ctx context.Context, action Action) error {
+	query := `
+		INSERT INTO moderation_actions (moderator_id, action, target_user_id, message_id, report_id, note)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.Exec(ctx, query, action.ModeratorID, action.Action, action.TargetUserID, action.MessageID, action.ReportID, action.Note)
+	if err != nil {
+		return fmt.Errorf("failed to log moderation action: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) LogFilterDecisions(ctx context.Context, decisions []models.FilterDecision) error {
+	query := `
+		INSERT INTO filter_decisions (chat_id, sender_id, message_id, filter, action, reason, text)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	batch := &pgx.Batch{}
+	for _, d := range decisions {
+		batch.Queue(query, d.ChatID, d.SenderID, d.MessageID, d.Filter, d.Action, d.Reason, d.Text)
+	}
+	if err := r.db.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to log filter decisions: %w", err)
+	}
+	return nil
+}
+
+// ListFilterDecisions returns decisions newest first, starting below
+// beforeID when it is non-zero. An empty action lists every action.
+func (r *postgresRepository) ListFilterDecisions(ctx context.Context, action string, beforeID int64, limit int) ([]models.FilterDecision, error) {
+	query := `
+		SELECT id, chat_id, sender_id, message_id, filter, action, reason, text, created_at
+		FROM filter_decisions
+		WHERE ($1 = '' OR action = $1) AND ($2 = 0 OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`
+	rows, err := r.db.Query(ctx, query, action, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query filter decisions: %w", err)
+	}
+	defer rows.Close()
+
+	var decisions []models.FilterDecision
+	for rows.Next() {
+		var d models.FilterDecision
+		if err := rows.Scan(&d.ID, &d.ChatID, &d.SenderID, &d.MessageID, &d.Filter, &d.Action, &d.Reason, &d.Text, &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan filter decision row: %w", err)
+		}
+		decisions = append(decisions, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating filter decision rows: %w", err)
+	}
+
+	return decisions, nil
+}
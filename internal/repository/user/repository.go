@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
-	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -13,14 +16,36 @@ var (
 	ErrUserNotFound = errors.New("user not found")
 )
 
+const foreignKeyViolation = "23503"
+
 type User struct {
 	ID           int64
 	PasswordHash []byte
 }
 
+type PrivacySettings struct {
+	HideForwardSender bool
+}
+
+type UserSummary struct {
+	ID       int64
+	Username string
+}
+
+type BlockedUser struct {
+	UserSummary
+	BlockedAt time.Time
+}
+
 type UserRepository interface {
 	Create(ctx context.Context, email, username string, passHash []byte) (int64, error)
 	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetPrivacySettings(ctx context.Context, userID int64) (PrivacySettings, error)
+	UpdatePrivacySettings(ctx context.Context, userID int64, settings PrivacySettings) error
+	BlockUser(ctx context.Context, blockerID, blockedID int64) error
+	UnblockUser(ctx context.Context, blockerID, blockedID int64) error
+	ListBlocked(ctx context.Context, blockerID int64) ([]BlockedUser, error)
+	SearchUsers(ctx context.Context, userID int64, query string, limit int) ([]UserSummary, error)
 }
 
 type postgresRepository struct {
@@ -57,3 +82,128 @@ func (r *postgresRepository) GetByEmail(ctx context.Context, email string) (*Use
 
 	return &user, nil
 }
+
+func (r *postgresRepository) GetPrivacySettings(ctx context.Context, userID int64) (PrivacySettings, error) {
+	query := "SELECT hide_forward_sender FROM users WHERE id = $1"
+
+	var settings PrivacySettings
+	err := r.db.QueryRow(ctx, query, userID).Scan(&settings.HideForwardSender)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return PrivacySettings{}, ErrUserNotFound
+		}
+		return PrivacySettings{}, fmt.Errorf("failed to get privacy settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+func (r *postgresRepository) UpdatePrivacySettings(ctx context.Context, userID int64, settings PrivacySettings) error {
+	query := "UPDATE users SET hide_forward_sender = $2 WHERE id = $1"
+
+	tag, err := r.db.Exec(ctx, query, userID, settings.HideForwardSender)
+	if err != nil {
+		return fmt.Errorf("failed to update privacy settings: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) BlockUser(ctx context.Context, blockerID, blockedID int64) error {
+	query := "INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+
+	if _, err := r.db.Exec(ctx, query, blockerID, blockedID); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) UnblockUser(ctx context.Context, blockerID, blockedID int64) error {
+	query := "DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2"
+
+	if _, err := r.db.Exec(ctx, query, blockerID, blockedID); err != nil {
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) ListBlocked(ctx context.Context, blockerID int64) ([]BlockedUser, error) {
+	query := `
+		SELECT u.id, u.username, b.created_at
+		FROM user_blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, blockerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query blocked users: %w", err)
+	}
+	defer rows.Close()
+
+	var blocked []BlockedUser
+	for rows.Next() {
+		var b BlockedUser
+		if err := rows.Scan(&b.ID, &b.Username, &b.BlockedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan blocked user row: %w", err)
+		}
+		blocked = append(blocked, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating blocked user rows: %w", err)
+	}
+
+	return blocked, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// SearchUsers finds users whose username starts with query, ignoring case.
+// The caller, users they blocked and users who blocked them are left out.
+func (r *postgresRepository) SearchUsers(ctx context.Context, userID int64, query string, limit int) ([]UserSummary, error) {
+	sqlQuery := `
+		SELECT u.id, u.username
+		FROM users u
+		WHERE LOWER(u.username) LIKE $2 AND u.id <> $1
+		  AND NOT EXISTS(
+		      SELECT 1 FROM user_blocks b
+		      WHERE (b.blocker_id = $1 AND b.blocked_id = u.id)
+		         OR (b.blocker_id = u.id AND b.blocked_id = $1)
+		  )
+		ORDER BY LOWER(u.username), u.id
+		LIMIT $3
+	`
+	pattern := likeEscaper.Replace(strings.ToLower(query)) + "%"
+
+	rows, err := r.db.Query(ctx, sqlQuery, userID, pattern, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []UserSummary
+	for rows.Next() {
+		var u UserSummary
+		if err := rows.Scan(&u.ID, &u.Username); err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user rows: %w", err)
+	}
+
+	return users, nil
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/christmas-fire/nexus/internal/repository/user"
@@ -21,6 +22,7 @@ var (
 	ErrUserAlreadyExists  = errors.New("user with this email already exists")
 	ErrInvalidCredentials = errors.New("invalid email or password")
 	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidToken       = errors.New("invalid token")
 )
 
 type AuthService struct {
@@ -96,3 +98,27 @@ func (s *AuthService) Login(ctx context.Context, email, password string) (string
 
 	return signedToken, nil
 }
+
+// ValidateToken checks an access token and returns the user it was issued
+// to.
+func (s *AuthService) ValidateToken(tokenString string) (int64, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(s.tokenSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return 0, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(*jwt.RegisteredClaims)
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil || userID <= 0 {
+		return 0, ErrInvalidToken
+	}
+	return userID, nil
+}
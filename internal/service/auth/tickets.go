@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrInvalidTicket = errors.New("invalid or expired ticket")
+
+const ticketKeyPrefix = "ws:ticket:"
+
+// TicketStore hands out short-lived, single-use tickets that stand in for
+// an access token where a client cannot send headers, as when a browser
+// opens a WebSocket. A ticket in a URL may end up in logs, so unlike the
+// token itself it is useless once redeemed or expired.
+type TicketStore struct {
+	redis *redis.Client
+	ttl   time.Duration
+}
+
+func NewTicketStore(redisClient *redis.Client, ttl time.Duration) *TicketStore {
+	return &TicketStore{redis: redisClient, ttl: ttl}
+}
+
+// Issue returns a ticket for token and when it expires. The token must
+// already have been validated.
+func (t *TicketStore) Issue(ctx context.Context, token string) (string, time.Time, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate ticket: %w", err)
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(b)
+
+	expiresAt := time.Now().Add(t.ttl)
+	if err := t.redis.Set(ctx, ticketKeyPrefix+ticket, token, t.ttl).Err(); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to store ticket: %w", err)
+	}
+	return ticket, expiresAt, nil
+}
+
+// Redeem returns the token a ticket stands for and invalidates the ticket.
+func (t *TicketStore) Redeem(ctx context.Context, ticket string) (string, error) {
+	if ticket == "" {
+		return "", ErrInvalidTicket
+	}
+	token, err := t.redis.GetDel(ctx, ticketKeyPrefix+ticket).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", ErrInvalidTicket
+		}
+		return "", fmt.Errorf("failed to redeem ticket: %w", err)
+	}
+	return token, nil
+}
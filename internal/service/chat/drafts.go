@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	"github.com/christmas-fire/nexus/internal/models"
+)
+
+const EventDraftUpdated = "draft_updated"
+
+// SaveDraft stores the user's draft for a chat and shows it on the user's
+// other sessions. originSession identifies the session the draft was typed
+// in, which does not get the update back. Blank text clears the draft.
+func (s *ChatService) SaveDraft(ctx context.Context, chatID string, userID int64, text string, entities []models.Entity, originSession string) (models.Draft, error) {
+	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return models.Draft{}, err
+	}
+	if !isMember {
+		return models.Draft{}, ErrPermissionDenied
+	}
+
+	draft := models.Draft{ChatID: chatID}
+	draft.Text, draft.Entities, err = sanitizeMessage(text, entities)
+	if err != nil && !errors.Is(err, ErrEmptyMessage) {
+		return models.Draft{}, err
+	}
+
+	draft.UpdatedAt, err = s.chatRepo.SaveDraft(ctx, userID, draft)
+	if err != nil {
+		return models.Draft{}, err
+	}
+
+	s.publishSessionEvent(ctx, EventDraftUpdated, chatID, []int64{userID}, originSession, draft)
+	return draft, nil
+}
+
+func (s *ChatService) GetDrafts(ctx context.Context, userID int64) ([]models.Draft, error) {
+	return s.chatRepo.GetDrafts(ctx, userID)
+}
@@ -0,0 +1,242 @@
+package controller
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/christmas-fire/nexus/internal/models"
+)
+
+const (
+	MaxMessageLength = 4096
+	maxEntities      = 100
+	maxEntityURLLen  = 2048
+)
+
+var (
+	ErrEmptyMessage    = errors.New("message text cannot be empty")
+	ErrMessageTooLong  = errors.New("message text is too long")
+	ErrInvalidEntities = errors.New("invalid message entities")
+)
+
+// clientEntityTypes are the entity types a sender may supply. Mentions are
+// derived by the server from the text and never trusted from clients.
+var clientEntityTypes = map[string]bool{
+	models.EntityBold:          true,
+	models.EntityItalic:        true,
+	models.EntityStrikethrough: true,
+	models.EntityCode:          true,
+	models.EntityPre:           true,
+	models.EntityLink:          true,
+}
+
+var allowedLinkSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+// sanitizeMessage normalizes text and remaps the sender's entities onto the
+// result. It replaces invalid UTF-8, drops control and bidi-override
+// characters, converts CRLF to LF and trims surrounding whitespace.
+func sanitizeMessage(text string, entities []models.Entity) (string, []models.Entity, error) {
+	text = strings.ToValidUTF8(text, "\uFFFD")
+	runes := []rune(text)
+
+	// newPos[i] is the index in the sanitized text of the first kept rune at
+	// or after original rune i.
+	newPos := make([]int, len(runes)+1)
+	kept := make([]rune, 0, len(runes))
+	for i, r := range runes {
+		newPos[i] = len(kept)
+		if r == '\r' && i+1 < len(runes) && runes[i+1] == '\n' {
+			continue
+		}
+		if r == '\r' {
+			r = '\n'
+		}
+		if isDisallowedRune(r) {
+			continue
+		}
+		kept = append(kept, r)
+	}
+	newPos[len(runes)] = len(kept)
+
+	start, end := 0, len(kept)
+	for start < end && unicode.IsSpace(kept[start]) {
+		start++
+	}
+	for end > start && unicode.IsSpace(kept[end-1]) {
+		end--
+	}
+
+	sanitized := string(kept[start:end])
+	if sanitized == "" {
+		return "", nil, ErrEmptyMessage
+	}
+	if utf8.RuneCountInString(sanitized) > MaxMessageLength {
+		return "", nil, ErrMessageTooLong
+	}
+
+	clamp := func(p int) int {
+		p = newPos[p] - start
+		if p < 0 {
+			return 0
+		}
+		if p > end-start {
+			return end - start
+		}
+		return p
+	}
+
+	if len(entities) > maxEntities {
+		return "", nil, ErrInvalidEntities
+	}
+
+	var result []models.Entity
+	for _, e := range entities {
+		if !clientEntityTypes[e.Type] || e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > len(runes) {
+			return "", nil, ErrInvalidEntities
+		}
+
+		entity := models.Entity{Type: e.Type}
+		if e.Type == models.EntityLink {
+			link, err := sanitizeLink(e.URL)
+			if err != nil {
+				return "", nil, err
+			}
+			entity.URL = link
+		}
+
+		from, to := clamp(e.Offset), clamp(e.Offset+e.Length)
+		if to <= from {
+			continue
+		}
+		entity.Offset, entity.Length = from, to-from
+		result = append(result, entity)
+	}
+
+	sortEntities(result)
+	if err := validateEntityNesting(result); err != nil {
+		return "", nil, err
+	}
+
+	return sanitized, result, nil
+}
+
+func isDisallowedRune(r rune) bool {
+	switch {
+	case r == '\n' || r == '\t':
+		return false
+	case r == utf8.RuneError:
+		return false
+	case unicode.IsControl(r):
+		return true
+	case r >= '\u202A' && r <= '\u202E', r >= '\u2066' && r <= '\u2069':
+		return true
+	}
+	return false
+}
+
+func sanitizeLink(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || len(raw) > maxEntityURLLen {
+		return "", ErrInvalidEntities
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || !allowedLinkSchemes[strings.ToLower(u.Scheme)] {
+		return "", ErrInvalidEntities
+	}
+	if u.Scheme != "mailto" && u.Host == "" {
+		return "", ErrInvalidEntities
+	}
+
+	return u.String(), nil
+}
+
+// validateEntityNesting requires entities to be either disjoint or fully
+// nested, and code blocks to contain no other formatting.
+func validateEntityNesting(entities []models.Entity) error {
+	var open []models.Entity
+	for _, e := range entities {
+		for len(open) > 0 && open[len(open)-1].Offset+open[len(open)-1].Length <= e.Offset {
+			open = open[:len(open)-1]
+		}
+		if len(open) > 0 {
+			parent := open[len(open)-1]
+			if e.Offset+e.Length > parent.Offset+parent.Length {
+				return ErrInvalidEntities
+			}
+			if parent.Type == models.EntityCode || parent.Type == models.EntityPre {
+				return ErrInvalidEntities
+			}
+		}
+		open = append(open, e)
+	}
+	return nil
+}
+
+func sortEntities(entities []models.Entity) {
+	sort.SliceStable(entities, func(i, j int) bool {
+		if entities[i].Offset != entities[j].Offset {
+			return entities[i].Offset < entities[j].Offset
+		}
+		return entities[i].Length > entities[j].Length
+	})
+}
+
+// filterMentions drops mentions inside code spans and mentions that would
+// partially overlap a formatting entity.
+func filterMentions(mentions []models.Mention, formatting []models.Entity) []models.Mention {
+	var result []models.Mention
+	for _, m := range mentions {
+		if !conflictsWithFormatting(m.Offset, m.Length, formatting) {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func conflictsWithFormatting(offset, length int, formatting []models.Entity) bool {
+	end := offset + length
+	for _, e := range formatting {
+		eEnd := e.Offset + e.Length
+		if end <= e.Offset || eEnd <= offset {
+			continue
+		}
+		if e.Type == models.EntityCode || e.Type == models.EntityPre {
+			return true
+		}
+		nested := (e.Offset <= offset && end <= eEnd) || (offset <= e.Offset && eEnd <= end)
+		if !nested {
+			return true
+		}
+	}
+	return false
+}
+
+// buildEntities merges formatting with presentation entities for mentions.
+func buildEntities(formatting []models.Entity, mentions []models.Mention) []models.Entity {
+	entities := append([]models.Entity(nil), formatting...)
+	seen := make(map[[2]int]bool)
+	for _, m := range mentions {
+		key := [2]int{m.Offset, m.Length}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		entity := models.Entity{Type: models.EntityMention, Offset: m.Offset, Length: m.Length}
+		if !m.All {
+			entity.UserID = m.UserID
+		}
+		entities = append(entities, entity)
+	}
+	sortEntities(entities)
+	return entities
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/christmas-fire/nexus/internal/models"
+)
+
+func TestSanitizeMessage(t *testing.T) {
+	bold := func(offset, length int) models.Entity {
+		return models.Entity{Type: models.EntityBold, Offset: offset, Length: length}
+	}
+	italic := func(offset, length int) models.Entity {
+		return models.Entity{Type: models.EntityItalic, Offset: offset, Length: length}
+	}
+
+	tests := []struct {
+		name         string
+		text         string
+		entities     []models.Entity
+		wantText     string
+		wantEntities []models.Entity
+	}{
+		{
+			name:         "crlf collapses to lf",
+			text:         "a\r\nb",
+			entities:     []models.Entity{bold(3, 1)},
+			wantText:     "a\nb",
+			wantEntities: []models.Entity{bold(2, 1)},
+		},
+		{
+			name:         "lone cr becomes lf",
+			text:         "a\rb",
+			entities:     []models.Entity{bold(0, 3)},
+			wantText:     "a\nb",
+			wantEntities: []models.Entity{bold(0, 3)},
+		},
+		{
+			name:         "entity starting on a removed rune",
+			text:         "a\u202ebc",
+			entities:     []models.Entity{bold(1, 2)},
+			wantText:     "abc",
+			wantEntities: []models.Entity{bold(1, 1)},
+		},
+		{
+			name:         "removed rune on an entity boundary",
+			text:         "ab\u2066cd",
+			entities:     []models.Entity{bold(0, 3), italic(2, 3)},
+			wantText:     "abcd",
+			wantEntities: []models.Entity{bold(0, 2), italic(2, 2)},
+		},
+		{
+			name:     "entity covering only removed runes is dropped",
+			text:     "a\u0007b",
+			entities: []models.Entity{italic(1, 1)},
+			wantText: "ab",
+		},
+		{
+			name:         "trimmed whitespace shifts entities",
+			text:         "  hi  ",
+			entities:     []models.Entity{bold(2, 2), italic(0, 1)},
+			wantText:     "hi",
+			wantEntities: []models.Entity{bold(0, 2)},
+		},
+		{
+			name: "multi-byte runes",
+			text: "żółw\r\n🐢 ok",
+			entities: []models.Entity{
+				{Type: models.EntityLink, Offset: 8, Length: 2, URL: " https://example.com "},
+				bold(6, 1),
+			},
+			wantText: "żółw\n🐢 ok",
+			wantEntities: []models.Entity{
+				bold(5, 1),
+				{Type: models.EntityLink, Offset: 7, Length: 2, URL: "https://example.com"},
+			},
+		},
+		{
+			name:         "invalid utf-8 is replaced",
+			text:         "a\xffb",
+			entities:     []models.Entity{bold(2, 1)},
+			wantText:     "a\ufffdb",
+			wantEntities: []models.Entity{bold(2, 1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities, err := sanitizeMessage(tt.text, tt.entities)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text != tt.wantText {
+				t.Errorf("text = %q, want %q", text, tt.wantText)
+			}
+			if !reflect.DeepEqual(entities, tt.wantEntities) {
+				t.Errorf("entities = %+v, want %+v", entities, tt.wantEntities)
+			}
+		})
+	}
+}
+
+func TestSanitizeMessageErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []models.Entity
+		want     error
+	}{
+		{name: "only removed runes", text: " \u202e\r\n\t", want: ErrEmptyMessage},
+		{name: "entity past the end", text: "hi", entities: []models.Entity{{Type: models.EntityBold, Offset: 1, Length: 5}}, want: ErrInvalidEntities},
+		{name: "partial overlap", text: "hello", entities: []models.Entity{{Type: models.EntityBold, Offset: 0, Length: 3}, {Type: models.EntityItalic, Offset: 2, Length: 3}}, want: ErrInvalidEntities},
+		{name: "formatting inside code", text: "hello", entities: []models.Entity{{Type: models.EntityCode, Offset: 0, Length: 5}, {Type: models.EntityBold, Offset: 1, Length: 2}}, want: ErrInvalidEntities},
+		{name: "client mention", text: "@bob", entities: []models.Entity{{Type: models.EntityMention, Offset: 0, Length: 4, UserID: 1}}, want: ErrInvalidEntities},
+		{name: "unsafe link", text: "click", entities: []models.Entity{{Type: models.EntityLink, Offset: 0, Length: 5, URL: "javascript:alert(1)"}}, want: ErrInvalidEntities},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := sanitizeMessage(tt.text, tt.entities); !errors.Is(err, tt.want) {
+				t.Errorf("sanitizeMessage() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
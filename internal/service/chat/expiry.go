@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/models"
+)
+
+var (
+	ErrInvalidMessageTTL = errors.New("message ttl must be zero or between 5 seconds and 365 days, in whole seconds")
+)
+
+const (
+	minMessageTTL = 5 * time.Second
+	maxMessageTTL = 365 * 24 * time.Hour
+
+	defaultReapInterval = 5 * time.Second
+	reapBatchSize       = 500
+)
+
+// SetMessageTTL makes new messages in the chat disappear ttl after they are
+// sent. Only admins can change it; a zero ttl turns disappearing messages off.
+func (s *ChatService) SetMessageTTL(ctx context.Context, chatID string, userID int64, ttl time.Duration) error {
+	if ttl != 0 && (ttl < minMessageTTL || ttl > maxMessageTTL || ttl%time.Second != 0) {
+		return ErrInvalidMessageTTL
+	}
+
+	if err := s.requireAdmin(ctx, chatID, userID); err != nil {
+		return err
+	}
+
+	if err := s.chatRepo.SetMessageTTL(ctx, chatID, ttl); err != nil {
+		return err
+	}
+
+	s.publishEvent(ctx, EventMessageTTLChanged, chatID, models.MessageTTLChanged{
+		ChatID:     chatID,
+		TTLSeconds: int64(ttl / time.Second),
+		ChangedBy:  userID,
+		ChangedAt:  time.Now(),
+	})
+	return nil
+}
+
+// Reaper deletes expired messages and tells the members of their chats to
+// drop them. Reads already hide expired messages, so a late run only delays
+// reclaiming storage.
+type Reaper struct {
+	service  *ChatService
+	interval time.Duration
+}
+
+func NewReaper(service *ChatService) *Reaper {
+	return &Reaper{service: service, interval: defaultReapInterval}
+}
+
+func (rp *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(rp.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rp.reap(ctx)
+		}
+	}
+}
+
+func (rp *Reaper) reap(ctx context.Context) {
+	for ctx.Err() == nil {
+		expired, err := rp.service.chatRepo.DeleteExpiredMessages(ctx, reapBatchSize)
+		if err != nil {
+			log.Printf("failed to delete expired messages: %v", err)
+			return
+		}
+
+		byChat := make(map[string][]string)
+		for _, msg := range expired {
+			byChat[msg.ChatID] = append(byChat[msg.ChatID], msg.ID)
+		}
+		for chatID, ids := range byChat {
+			rp.service.publishEvent(ctx, EventMessagesExpired, chatID, models.MessagesExpired{
+				ChatID:     chatID,
+				MessageIDs: ids,
+			})
+		}
+
+		if len(expired) < reapBatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/christmas-fire/nexus/internal/models"
+)
+
+const mentionAllKeyword = "all"
+
+var mentionPattern = regexp.MustCompile(`@([\p{L}\p{N}_.-]+)`)
+
+type mentionToken struct {
+	offset   int
+	length   int
+	username string
+}
+
+// parseMentionTokens finds @name tokens that are not part of a longer word,
+// so e-mail addresses like user@example.com are not treated as mentions.
+func parseMentionTokens(text string) []mentionToken {
+	var tokens []mentionToken
+	for _, loc := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := loc[0], loc[1]
+		if start > 0 {
+			prev, _ := utf8.DecodeLastRuneInString(text[:start])
+			if unicode.IsLetter(prev) || unicode.IsDigit(prev) || prev == '_' || prev == '@' {
+				continue
+			}
+		}
+
+		name := strings.TrimRight(text[loc[2]:loc[3]], ".-")
+		end = loc[2] + len(name)
+		if name == "" {
+			continue
+		}
+
+		tokens = append(tokens, mentionToken{
+			offset:   utf8.RuneCountInString(text[:start]),
+			length:   utf8.RuneCountInString(text[start:end]),
+			username: strings.ToLower(name),
+		})
+	}
+	return tokens
+}
+
+// resolveMentions turns @name tokens into mention entities. Only members of
+// the chat can be mentioned; unknown names are left as plain text.
+func (s *ChatService) resolveMentions(ctx context.Context, chatID, text string) ([]models.Mention, error) {
+	tokens := parseMentionTokens(text)
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	var usernames []string
+	for _, t := range tokens {
+		if t.username != mentionAllKeyword {
+			usernames = append(usernames, t.username)
+		}
+	}
+
+	var members map[string][]int64
+	if len(usernames) > 0 {
+		var err error
+		members, err = s.chatRepo.FindMembersByUsernames(ctx, chatID, usernames)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var mentions []models.Mention
+	for _, t := range tokens {
+		if t.username == mentionAllKeyword {
+			mentions = append(mentions, models.Mention{Offset: t.offset, Length: t.length, All: true})
+			continue
+		}
+		for _, userID := range members[t.username] {
+			mentions = append(mentions, models.Mention{Offset: t.offset, Length: t.length, UserID: userID})
+		}
+	}
+	return mentions, nil
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	defaultRelayInterval = time.Second
+	relayBatchSize       = 100
+)
+
+// OutboxRelay publishes the events written to the outbox along with the
+// messages they announce. Every event is published at least once, in order
+// within its chat, unless it keeps failing and is set aside as dead; any
+// number of replicas can run a relay.
+type OutboxRelay struct {
+	service  *ChatService
+	interval time.Duration
+}
+
+func NewOutboxRelay(service *ChatService) *OutboxRelay {
+	return &OutboxRelay{service: service, interval: defaultRelayInterval}
+}
+
+// Run relays events as soon as this instance writes some, and polls for
+// the rest: those written by other instances and those being retried.
+func (rl *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(rl.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-rl.service.relayWake:
+		}
+		rl.relay(ctx)
+	}
+}
+
+// relay drains the due events, one batch at a time. Like scheduled
+// deliveries, a batch is finished even on shutdown so that events already
+// published are not left in the outbox to be published again.
+func (rl *OutboxRelay) relay(ctx context.Context) {
+	batchCtx := context.WithoutCancel(ctx)
+	for ctx.Err() == nil {
+		n, err := rl.service.chatRepo.RelayOutbox(batchCtx, relayBatchSize, rl.service.events.Deliver)
+		if err != nil {
+			log.Printf("failed to relay outbox events: %v", err)
+			return
+		}
+		if n < relayBatchSize {
+			return
+		}
+	}
+}
+
+// wakeRelay is called after events were written to the outbox.
+func (s *ChatService) wakeRelay() {
+	select {
+	case s.relayWake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"github.com/christmas-fire/nexus/internal/models"
+	"github.com/christmas-fire/nexus/internal/repository/chat"
+	"github.com/christmas-fire/nexus/internal/service/filter"
+)
+
+var (
+	ErrInvalidPoll  = errors.New("invalid poll")
+	ErrInvalidVote  = errors.New("invalid vote")
+	ErrPollNotFound = chat.ErrPollNotFound
+	ErrPollClosed   = chat.ErrPollClosed
+)
+
+const (
+	EventPollUpdated = "poll_updated"
+
+	maxPollQuestionLength = 300
+	maxPollOptionLength   = 100
+	minPollOptions        = 2
+	maxPollOptions        = 10
+)
+
+func (s *ChatService) CreatePoll(ctx context.Context, chatID string, userID int64, poll chat.NewPoll) (models.Message, error) {
+	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return models.Message{}, err
+	}
+	if !isMember {
+		return models.Message{}, ErrPermissionDenied
+	}
+	if err := s.requireNotBlocked(ctx, chatID, userID); err != nil {
+		return models.Message{}, err
+	}
+
+	poll, err = validatePoll(poll)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	// The question and every option are screened like message text.
+	texts := append([]string{poll.Question}, poll.Options...)
+	screened := make([]filter.Message, len(texts))
+	verdicts := make([]filter.Result, len(texts))
+	seen := make(map[string]bool, len(poll.Options))
+	for i, text := range texts {
+		screened[i] = filter.Message{ChatID: chatID, SenderID: userID, Text: text}
+		if verdicts[i], err = s.screen(ctx, screened[i]); err != nil {
+			return models.Message{}, err
+		}
+		if i == 0 {
+			poll.Question = verdicts[i].Text
+			continue
+		}
+		// Masking can make two options read the same.
+		if seen[verdicts[i].Text] {
+			return models.Message{}, ErrInvalidPoll
+		}
+		seen[verdicts[i].Text] = true
+		poll.Options[i-1] = verdicts[i].Text
+	}
+
+	options := make([]models.PollOption, len(poll.Options))
+	for i, text := range poll.Options {
+		options[i].Text = text
+	}
+
+	msg := models.Message{
+		ChatID:   chatID,
+		SenderID: userID,
+		Text:     poll.Question,
+		Poll: &models.Poll{
+			Question:       poll.Question,
+			Options:        options,
+			MultipleChoice: poll.MultipleChoice,
+			Anonymous:      poll.Anonymous,
+			ClosesAt:       poll.ClosesAt,
+		},
+	}
+
+	sent, err := s.chatRepo.SendMessage(ctx, chat.NewMessage{
+		ChatID:   chatID,
+		SenderID: userID,
+		Text:     poll.Question,
+		Poll:     &poll,
+		Events:   messageEvents(msg),
+	})
+	if err != nil {
+		return models.Message{}, err
+	}
+	s.wakeRelay()
+	for i := range screened {
+		s.filters.Record(ctx, screened[i], verdicts[i], sent.ID)
+	}
+	s.filters.Track(ctx, screened...)
+
+	msg.ID, msg.SentAt, msg.ExpiresAt = sent.ID, sent.SentAt, sent.ExpiresAt
+	return msg, nil
+}
+
+// validatePoll cleans up the question and options the same way message text
+// is cleaned up, and checks the poll's shape.
+func validatePoll(poll chat.NewPoll) (chat.NewPoll, error) {
+	question, _, err := sanitizeMessage(poll.Question, nil)
+	if err != nil || utf8.RuneCountInString(question) > maxPollQuestionLength {
+		return chat.NewPoll{}, ErrInvalidPoll
+	}
+	poll.Question = question
+
+	if len(poll.Options) < minPollOptions || len(poll.Options) > maxPollOptions {
+		return chat.NewPoll{}, ErrInvalidPoll
+	}
+	options := make([]string, 0, len(poll.Options))
+	seen := make(map[string]bool, len(poll.Options))
+	for _, option := range poll.Options {
+		text, _, err := sanitizeMessage(option, nil)
+		if err != nil || utf8.RuneCountInString(text) > maxPollOptionLength || seen[text] {
+			return chat.NewPoll{}, ErrInvalidPoll
+		}
+		seen[text] = true
+		options = append(options, text)
+	}
+	poll.Options = options
+
+	if poll.ClosesAt != nil && !poll.ClosesAt.After(time.Now()) {
+		return chat.NewPoll{}, ErrInvalidPoll
+	}
+
+	return poll, nil
+}
+
+// Vote replaces the user's choices in a poll and returns the poll as the
+// user now sees it.
+func (s *ChatService) Vote(ctx context.Context, chatID, messageID string, userID int64, options []int) (*models.Poll, error) {
+	if len(options) == 0 {
+		return nil, ErrInvalidVote
+	}
+	return s.setPollVotes(ctx, chatID, messageID, userID, options)
+}
+
+func (s *ChatService) RetractVote(ctx context.Context, chatID, messageID string, userID int64) (*models.Poll, error) {
+	return s.setPollVotes(ctx, chatID, messageID, userID, nil)
+}
+
+func (s *ChatService) setPollVotes(ctx context.Context, chatID, messageID string, userID int64, options []int) (*models.Poll, error) {
+	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrPermissionDenied
+	}
+
+	poll, err := s.getPoll(ctx, chatID, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if poll.Closed {
+		return nil, ErrPollClosed
+	}
+
+	options = uniqueInts(options)
+	if len(options) > 1 && !poll.MultipleChoice {
+		return nil, ErrInvalidVote
+	}
+	for _, option := range options {
+		if option < 0 || option >= len(poll.Options) {
+			return nil, ErrInvalidVote
+		}
+	}
+
+	if err := s.chatRepo.SetPollVotes(ctx, messageID, userID, options); err != nil {
+		return nil, err
+	}
+
+	poll, err = s.getPoll(ctx, chatID, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The broadcast carries tallies only; Chosen is specific to the voter.
+	shared := *poll
+	shared.Options = make([]models.PollOption, len(poll.Options))
+	for i, option := range poll.Options {
+		option.Chosen = false
+		shared.Options[i] = option
+	}
+	s.publishEvent(ctx, EventPollUpdated, chatID, models.PollUpdated{
+		ChatID:    chatID,
+		MessageID: messageID,
+		Poll:      shared,
+	})
+
+	return poll, nil
+}
+
+func (s *ChatService) getPoll(ctx context.Context, chatID, messageID string, viewerID int64) (*models.Poll, error) {
+	polls, err := s.chatRepo.GetPolls(ctx, chatID, []string{messageID}, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	poll, ok := polls[messageID]
+	if !ok {
+		return nil, ErrPollNotFound
+	}
+	return poll, nil
+}
+
+// attachPolls fills in the polls among messages, as seen by viewerID.
+func (s *ChatService) attachPolls(ctx context.Context, chatID string, messages []models.Message, viewerID int64) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+
+	polls, err := s.chatRepo.GetPolls(ctx, chatID, ids, viewerID)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Poll = polls[messages[i].ID]
+	}
+	return nil
+}
+
+func uniqueInts(values []int) []int {
+	seen := make(map[int]bool, len(values))
+	var list []int
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			list = append(list, v)
+		}
+	}
+	return list
+}
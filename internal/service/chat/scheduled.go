@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/models"
+	"github.com/christmas-fire/nexus/internal/repository/chat"
+)
+
+var (
+	ErrScheduledMessageNotFound = chat.ErrScheduledMessageNotFound
+	ErrInvalidSendTime          = errors.New("send time must be in the future and within a year")
+	ErrTooManyScheduled         = errors.New("too many scheduled messages")
+	ErrSenderSuspended          = errors.New("sender is suspended")
+)
+
+const (
+	maxScheduleAhead        = 365 * 24 * time.Hour
+	maxPendingScheduled     = 100
+	defaultScheduleInterval = time.Second
+	scheduleBatchSize       = 100
+)
+
+func (s *ChatService) ScheduleMessage(ctx context.Context, chatID string, senderID int64, text string, entities []models.Entity, sendAt time.Time) (chat.ScheduledMessage, error) {
+	isMember, err := s.chatRepo.IsMember(ctx, chatID, senderID)
+	if err != nil {
+		return chat.ScheduledMessage{}, err
+	}
+	if !isMember {
+		return chat.ScheduledMessage{}, ErrPermissionDenied
+	}
+
+	text, entities, err = prepareScheduled(text, entities, sendAt)
+	if err != nil {
+		return chat.ScheduledMessage{}, err
+	}
+
+	pending, err := s.chatRepo.CountPendingScheduled(ctx, senderID)
+	if err != nil {
+		return chat.ScheduledMessage{}, err
+	}
+	if pending >= maxPendingScheduled {
+		return chat.ScheduledMessage{}, ErrTooManyScheduled
+	}
+
+	return s.chatRepo.CreateScheduledMessage(ctx, chat.ScheduledMessage{
+		ChatID:   chatID,
+		SenderID: senderID,
+		Text:     text,
+		Entities: entities,
+		SendAt:   sendAt,
+	})
+}
+
+func (s *ChatService) ListScheduledMessages(ctx context.Context, userID int64, chatID *string) ([]chat.ScheduledMessage, error) {
+	return s.chatRepo.ListScheduledMessages(ctx, userID, chatID)
+}
+
+func (s *ChatService) UpdateScheduledMessage(ctx context.Context, id string, userID int64, text string, entities []models.Entity, sendAt time.Time) (chat.ScheduledMessage, error) {
+	text, entities, err := prepareScheduled(text, entities, sendAt)
+	if err != nil {
+		return chat.ScheduledMessage{}, err
+	}
+
+	return s.chatRepo.UpdateScheduledMessage(ctx, chat.ScheduledMessage{
+		ID:       id,
+		SenderID: userID,
+		Text:     text,
+		Entities: entities,
+		SendAt:   sendAt,
+	})
+}
+
+func (s *ChatService) CancelScheduledMessage(ctx context.Context, id string, userID int64) error {
+	return s.chatRepo.CancelScheduledMessage(ctx, id, userID)
+}
+
+// prepareScheduled validates a message up front so the sender learns about
+// problems now rather than at delivery time. Only the formatting entities are
+// stored: mentions are resolved against the chat when the message is sent.
+func prepareScheduled(text string, entities []models.Entity, sendAt time.Time) (string, []models.Entity, error) {
+	now := time.Now()
+	if !sendAt.After(now) || sendAt.After(now.Add(maxScheduleAhead)) {
+		return "", nil, ErrInvalidSendTime
+	}
+
+	text, formatting, err := sanitizeMessage(text, entities)
+	if err != nil {
+		return "", nil, err
+	}
+	return text, formatting, nil
+}
+
+// Scheduler delivers scheduled messages once they are due. Any number of
+// replicas can run one: due rows are claimed with row locks, so each message
+// is sent once.
+// SuspensionChecker tells whether a user is suspended. The messages that
+// suspended users scheduled are not delivered.
+type SuspensionChecker interface {
+	IsSuspended(ctx context.Context, userID int64) (bool, error)
+}
+
+type Scheduler struct {
+	service     *ChatService
+	suspensions SuspensionChecker
+	interval    time.Duration
+}
+
+func NewScheduler(service *ChatService, suspensions SuspensionChecker) *Scheduler {
+	return &Scheduler{service: service, suspensions: suspensions, interval: defaultScheduleInterval}
+}
+
+func (sch *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(sch.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sch.deliverDue(ctx)
+		}
+	}
+}
+
+// deliverDue drains every due message, one batch at a time. A batch is not
+// interrupted by shutdown, so that messages are not left sending until
+// their lease runs out.
+func (sch *Scheduler) deliverDue(ctx context.Context) {
+	batchCtx := context.WithoutCancel(ctx)
+	for ctx.Err() == nil {
+		n, err := sch.service.chatRepo.DeliverDueScheduled(batchCtx, scheduleBatchSize, sch.deliver)
+		if err != nil {
+			log.Printf("failed to deliver scheduled messages: %v", err)
+			return
+		}
+		if n < scheduleBatchSize {
+			return
+		}
+	}
+}
+
+func (sch *Scheduler) deliver(ctx context.Context, msg chat.ScheduledMessage) (string, error) {
+	suspended, err := sch.suspensions.IsSuspended(ctx, msg.SenderID)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", chat.ErrRetryDelivery, err)
+	}
+	if suspended {
+		log.Printf("scheduled message %s not delivered: %v", msg.ID, ErrSenderSuspended)
+		return "", ErrSenderSuspended
+	}
+
+	// Keyed on the scheduled message, so a batch that is retried after its
+	// messages were stored does not send them twice.
+	messageID, _, err := sch.service.SendMessage(ctx, msg.ChatID, msg.SenderID, msg.Text, msg.Entities, "scheduled:"+msg.ID)
+	if err == nil {
+		return messageID, nil
+	}
+
+	switch {
+	case errors.Is(err, ErrPermissionDenied),
+		errors.Is(err, ErrBlocked),
+		errors.Is(err, ErrEmptyMessage),
+		errors.Is(err, ErrMessageTooLong),
+		errors.Is(err, ErrInvalidEntities),
+		errors.Is(err, ErrMessageRejected):
+		log.Printf("scheduled message %s could not be delivered: %v", msg.ID, err)
+		return "", err
+	default:
+		return "", fmt.Errorf("%w: %v", chat.ErrRetryDelivery, err)
+	}
+}
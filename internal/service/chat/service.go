@@ -2,38 +2,108 @@ package controller
 
 import (
 	"context"
-	"encoding/json"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/christmas-fire/nexus/internal/models"
 	"github.com/christmas-fire/nexus/internal/repository/chat"
+	"github.com/christmas-fire/nexus/internal/service/events"
+	"github.com/christmas-fire/nexus/internal/service/filter"
+	"github.com/christmas-fire/nexus/internal/service/preview"
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
 var (
-	ErrPermissionDenied = errors.New("permission denied")
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrMessageNotFound    = chat.ErrMessageNotFound
+	ErrEmptySearchQuery   = errors.New("search query cannot be empty")
+	ErrInvalidPageToken   = errors.New("invalid page token")
+	ErrInvalidSearchRange = errors.New("search range start must be before its end")
+	ErrNothingToForward   = errors.New("no messages to forward")
+	ErrTooManyToForward   = errors.New("too many messages to forward")
+	ErrBlocked            = errors.New("blocked by the other user")
+	ErrMessageRejected    = filter.ErrRejected
+	// ErrClientMessageIDReused is returned when a sender reuses a client
+	// message id of theirs for a different chat.
+	ErrClientMessageIDReused  = errors.New("client message id already used in another chat")
+	ErrInvalidClientMessageID = errors.New("client message id must be printable ASCII of at most 64 characters")
 )
 
 const (
-	messagesChannel = "messages"
+	EventNewMessage        = "new_message"
+	EventMessagePinned     = "message_pinned"
+	EventMentioned         = "mentioned"
+	EventMessageUpdate     = "message_updated"
+	EventMessagesExpired   = "messages_expired"
+	EventMessageTTLChanged = "message_ttl_changed"
+
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+
+	defaultMentionsPageSize = 50
+	maxMentionsPageSize     = 100
+
+	maxForwardMessages = 100
+
+	maxClientMessageIDLength = 64
+
+	defaultChatsPageSize = 50
+	minChatsPageSize     = maxPinnedChats + 10
+	maxChatsPageSize     = 200
 )
 
 type ChatService struct {
 	chatRepo chat.ChatRepository
 	redis    *redis.Client
+	filters  *filter.Pipeline
+	events   *events.Publisher
+	// relayWake tells the outbox relay that events were just written.
+	relayWake chan struct{}
 }
 
-func NewChatService(chatRepo chat.ChatRepository, redisClient *redis.Client) *ChatService {
-	return &ChatService{chatRepo: chatRepo, redis: redisClient}
+// NewChatService creates the chat service. filters screens every message
+// sent; it may be nil.
+func NewChatService(chatRepo chat.ChatRepository, redisClient *redis.Client, filters *filter.Pipeline, publisher *events.Publisher) *ChatService {
+	return &ChatService{chatRepo: chatRepo, redis: redisClient, filters: filters, events: publisher, relayWake: make(chan struct{}, 1)}
 }
 
-func (s *ChatService) CreateChat(ctx context.Context, name *string, memberIDs []int64) (string, error) {
-	return s.chatRepo.CreateChat(ctx, name, memberIDs)
+// CreateChat creates a chat. A direct chat, with a single other member,
+// cannot be started with someone who blocked the creator.
+func (s *ChatService) CreateChat(ctx context.Context, name *string, creatorID int64, memberIDs []int64) (string, error) {
+	var others []int64
+	for _, id := range memberIDs {
+		if id != creatorID {
+			others = append(others, id)
+		}
+	}
+	if len(others) == 1 {
+		blocked, err := s.chatRepo.IsBlocked(ctx, others[0], creatorID)
+		if err != nil {
+			return "", err
+		}
+		if blocked {
+			return "", ErrBlocked
+		}
+	}
+
+	chatID, err := s.chatRepo.CreateChat(ctx, name, creatorID, memberIDs)
+	if err != nil {
+		return "", err
+	}
+	s.events.MembersChanged(ctx, chatID)
+	return chatID, nil
 }
 
-func (s *ChatService) SendMessage(ctx context.Context, chatID string, senderID int64, text string) (string, time.Time, error) {
+// SendMessage stores and broadcasts a message. A non-empty clientMessageID
+// makes retries safe: sending again with the same id returns the message
+// stored the first time instead of storing another one.
+func (s *ChatService) SendMessage(ctx context.Context, chatID string, senderID int64, text string, entities []models.Entity, clientMessageID string) (string, time.Time, error) {
 	isMember, err := s.chatRepo.IsMember(ctx, chatID, senderID)
 	if err != nil {
 		return "", time.Time{}, err
@@ -41,35 +111,199 @@ func (s *ChatService) SendMessage(ctx context.Context, chatID string, senderID i
 	if !isMember {
 		return "", time.Time{}, ErrPermissionDenied
 	}
+	if err := s.requireNotBlocked(ctx, chatID, senderID); err != nil {
+		return "", time.Time{}, err
+	}
+
+	// Retries are answered only once the sender is known to still be allowed
+	// to post here, so a removed or blocked member cannot probe old ids.
+	var clientID *string
+	if clientMessageID != "" {
+		if !validClientMessageID(clientMessageID) {
+			return "", time.Time{}, ErrInvalidClientMessageID
+		}
 
-	if text == "" {
-		return "", time.Time{}, errors.New("message text cannot be empty")
+		existing, err := s.chatRepo.GetMessageByClientID(ctx, senderID, clientMessageID)
+		switch {
+		case err == nil:
+			if existing.ChatID != chatID {
+				return "", time.Time{}, ErrClientMessageIDReused
+			}
+			return existing.ID, existing.SentAt, nil
+		case !errors.Is(err, chat.ErrMessageNotFound):
+			return "", time.Time{}, err
+		}
+		clientID = &clientMessageID
 	}
 
-	messageID, sentAt, err := s.chatRepo.SendMessage(ctx, chatID, senderID, text)
+	text, formatting, err := sanitizeMessage(text, entities)
 	if err != nil {
 		return "", time.Time{}, err
 	}
 
-	msg := models.Message{
-		ID:       messageID,
-		ChatID:   chatID,
-		SenderID: senderID,
-		Text:     text,
-		SentAt:   sentAt,
+	filterMsg := filter.Message{ChatID: chatID, SenderID: senderID, Text: text, Entities: formatting}
+	verdict, err := s.screen(ctx, filterMsg)
+	if err != nil {
+		return "", time.Time{}, err
 	}
+	text = verdict.Text
 
-	msgBytes, err := json.Marshal(msg)
+	mentions, err := s.resolveMentions(ctx, chatID, text)
 	if err != nil {
-		log.Printf("failed to marshal message for redis: %v", err)
-		return messageID, sentAt, nil
+		return "", time.Time{}, err
+	}
+	mentions = filterMentions(mentions, formatting)
+	entities = buildEntities(formatting, mentions)
+
+	sent, err := s.chatRepo.SendMessage(ctx, chat.NewMessage{
+		ChatID:          chatID,
+		SenderID:        senderID,
+		Text:            text,
+		Mentions:        mentions,
+		Entities:        entities,
+		ClientMessageID: clientID,
+		Events: messageEvents(models.Message{
+			ChatID:          chatID,
+			SenderID:        senderID,
+			Text:            text,
+			Mentions:        mentions,
+			Entities:        entities,
+			ClientMessageID: clientMessageID,
+		}),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if sent.Duplicate {
+		// A concurrent retry stored the message first and announced it.
+		if sent.DuplicateChatID != chatID {
+			return "", time.Time{}, ErrClientMessageIDReused
+		}
+		return sent.ID, sent.SentAt, nil
+	}
+	s.wakeRelay()
+	s.filters.Record(ctx, filterMsg, verdict, sent.ID)
+	s.filters.Track(ctx, filterMsg)
+
+	if link := preview.FindURL(text, entities); link != "" {
+		job := preview.Job{ChatID: chatID, MessageID: sent.ID, URL: link}
+		if err := preview.Enqueue(ctx, s.redis, job); err != nil {
+			log.Printf("failed to enqueue link preview for message %s: %v", sent.ID, err)
+		}
+	}
+
+	return sent.ID, sent.SentAt, nil
+}
+
+// screen runs msg through the content filters. A rejection is recorded for
+// moderators and returned as ErrMessageRejected.
+func (s *ChatService) screen(ctx context.Context, msg filter.Message) (filter.Result, error) {
+	verdict := s.filters.Run(ctx, msg)
+	if verdict.Rejected {
+		s.filters.Record(ctx, msg, verdict, "")
+		return verdict, fmt.Errorf("%w: %s", ErrMessageRejected, verdict.Reason())
+	}
+	return verdict, nil
+}
+
+// messageEvents announces a new message: the returned function completes
+// msg with what was assigned when it was stored and builds its new_message
+// event, plus a mentioned event for the members it mentions.
+func messageEvents(msg models.Message) chat.EventsFunc {
+	return func(sent chat.SentMessage) ([]models.Event, error) {
+		msg.ID, msg.SentAt, msg.ExpiresAt = sent.ID, sent.SentAt, sent.ExpiresAt
+
+		newMessage, err := events.Encode(models.Event{
+			Type:     EventNewMessage,
+			ChatID:   msg.ChatID,
+			SenderID: msg.SenderID,
+		}, msg)
+		if err != nil {
+			return nil, err
+		}
+		if len(sent.MentionedUserIDs) == 0 {
+			return []models.Event{newMessage}, nil
+		}
+
+		mentioned := msg
+		mentioned.ClientMessageID = ""
+		mentionedEvent, err := events.Encode(models.Event{
+			Type:     EventMentioned,
+			ChatID:   msg.ChatID,
+			UserIDs:  sent.MentionedUserIDs,
+			SenderID: msg.SenderID,
+		}, mentioned)
+		if err != nil {
+			return nil, err
+		}
+		return []models.Event{newMessage, mentionedEvent}, nil
+	}
+}
+
+func validClientMessageID(id string) bool {
+	if len(id) > maxClientMessageIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
 	}
+	return true
+}
 
-	if err := s.redis.Publish(ctx, messagesChannel, msgBytes).Err(); err != nil {
-		log.Printf("failed to publish message to redis: %v", err)
+// AttachLinkPreview is called by the preview worker once a link in a
+// message has been unfurled.
+func (s *ChatService) AttachLinkPreview(ctx context.Context, chatID, messageID string, linkPreview models.LinkPreview) error {
+	if err := s.chatRepo.SetLinkPreview(ctx, chatID, messageID, linkPreview); err != nil {
+		return err
 	}
 
-	return messageID, sentAt, nil
+	msg, err := s.chatRepo.GetMessage(ctx, chatID, messageID)
+	if err != nil {
+		return err
+	}
+
+	s.publishMessageEvent(ctx, EventMessageUpdate, nil, msg)
+	return nil
+}
+
+// publishEvent broadcasts an event to the members of a chat. Failures are
+// only logged: the change itself is already persisted at this point.
+func (s *ChatService) publishEvent(ctx context.Context, eventType, chatID string, payload interface{}) {
+	s.publishUserEvent(ctx, eventType, chatID, nil, payload)
+}
+
+// publishUserEvent delivers an event about a chat only to the given users.
+// A nil userIDs means every member of the chat.
+func (s *ChatService) publishUserEvent(ctx context.Context, eventType, chatID string, userIDs []int64, payload interface{}) {
+	s.publishSessionEvent(ctx, eventType, chatID, userIDs, "", payload)
+}
+
+// publishSessionEvent is publishUserEvent for changes made from a WebSocket
+// session that already knows about them: exceptSession is not sent the event.
+func (s *ChatService) publishSessionEvent(ctx context.Context, eventType, chatID string, userIDs []int64, exceptSession string, payload interface{}) {
+	s.publish(ctx, models.Event{
+		Type:          eventType,
+		ChatID:        chatID,
+		UserIDs:       userIDs,
+		ExceptSession: exceptSession,
+	}, payload)
+}
+
+// publishMessageEvent delivers an event carrying a message. Members who
+// blocked the sender do not get it.
+func (s *ChatService) publishMessageEvent(ctx context.Context, eventType string, userIDs []int64, msg models.Message) {
+	s.publish(ctx, models.Event{
+		Type:     eventType,
+		ChatID:   msg.ChatID,
+		UserIDs:  userIDs,
+		SenderID: msg.SenderID,
+	}, msg)
+}
+
+func (s *ChatService) publish(ctx context.Context, event models.Event, payload interface{}) {
+	s.events.Publish(ctx, event, payload)
 }
 
 func (s *ChatService) GetChatHistory(ctx context.Context, chatID string, userID int64) ([]models.Message, error) {
@@ -82,9 +316,369 @@ func (s *ChatService) GetChatHistory(ctx context.Context, chatID string, userID
 	}
 
 	const messageLimit = 50
-	return s.chatRepo.GetHistory(ctx, chatID, messageLimit)
+	messages, err := s.chatRepo.GetHistory(ctx, chatID, messageLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.attachPolls(ctx, chatID, messages, userID); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// GetChatsByUserID returns a page of the user's chat list. Page sizes have a
+// floor above the pinned chat limit, so the first page always holds every
+// pinned chat and the cursor only has to track unpinned ones.
+func (s *ChatService) GetChatsByUserID(ctx context.Context, userID int64, includeArchived bool, pageSize int, pageToken string) ([]chat.ChatInfo, string, error) {
+	var after *chat.MessageCursor
+	if pageToken != "" {
+		cursor, err := decodeMessageCursor(pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		after = cursor
+	}
+
+	if pageSize <= 0 {
+		pageSize = defaultChatsPageSize
+	}
+	if pageSize < minChatsPageSize {
+		pageSize = minChatsPageSize
+	}
+	if pageSize > maxChatsPageSize {
+		pageSize = maxChatsPageSize
+	}
+
+	chats, err := s.chatRepo.GetChatsByUserID(ctx, userID, includeArchived, after, pageSize+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextPageToken string
+	if len(chats) > pageSize {
+		chats = chats[:pageSize]
+		last := chats[len(chats)-1]
+		nextPageToken = encodeMessageCursor(chat.MessageCursor{SentAt: last.LastActivityAt, ID: last.ID})
+	}
+
+	return chats, nextPageToken, nil
+}
+
+func (s *ChatService) SearchMessages(ctx context.Context, userID int64, filter chat.SearchFilter, pageToken string) ([]chat.SearchResult, string, error) {
+	filter.Query = strings.TrimSpace(filter.Query)
+	if filter.Query == "" {
+		return nil, "", ErrEmptySearchQuery
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, "", ErrInvalidSearchRange
+	}
+
+	if filter.ChatID != nil {
+		isMember, err := s.chatRepo.IsMember(ctx, *filter.ChatID, userID)
+		if err != nil {
+			return nil, "", err
+		}
+		if !isMember {
+			return nil, "", ErrPermissionDenied
+		}
+	}
+
+	if pageToken != "" {
+		cursor, err := decodeMessageCursor(pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		filter.After = cursor
+	}
+
+	pageSize := filter.Limit
+	if pageSize <= 0 {
+		pageSize = defaultSearchPageSize
+	}
+	if pageSize > maxSearchPageSize {
+		pageSize = maxSearchPageSize
+	}
+	filter.Limit = pageSize + 1
+
+	results, err := s.chatRepo.SearchMessages(ctx, userID, filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextPageToken string
+	if len(results) > pageSize {
+		results = results[:pageSize]
+		last := results[len(results)-1].Message
+		nextPageToken = encodeMessageCursor(chat.MessageCursor{SentAt: last.SentAt, ID: last.ID})
+	}
+
+	return results, nextPageToken, nil
+}
+
+func encodeMessageCursor(c chat.MessageCursor) string {
+	raw := strconv.FormatInt(c.SentAt.UnixMicro(), 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
 }
 
-func (s *ChatService) GetChatsByUserID(ctx context.Context, userID int64) ([]chat.ChatInfo, error) {
-	return s.chatRepo.GetChatsByUserID(ctx, userID)
+func decodeMessageCursor(token string) (*chat.MessageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	micros, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidPageToken
+	}
+	// The id ends up in a uuid query parameter, where garbage would be an
+	// internal error rather than a bad token.
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	usec, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	return &chat.MessageCursor{SentAt: time.UnixMicro(usec), ID: id}, nil
+}
+
+func (s *ChatService) PinMessage(ctx context.Context, chatID, messageID string, userID int64) (time.Time, error) {
+	if err := s.requireAdmin(ctx, chatID, userID); err != nil {
+		return time.Time{}, err
+	}
+
+	pinnedAt, err := s.chatRepo.PinMessage(ctx, chatID, messageID, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	s.publishEvent(ctx, EventMessagePinned, chatID, models.MessagePinned{
+		ChatID:    chatID,
+		MessageID: messageID,
+		Pinned:    true,
+		ChangedBy: userID,
+		ChangedAt: pinnedAt,
+	})
+
+	return pinnedAt, nil
+}
+
+func (s *ChatService) UnpinMessage(ctx context.Context, chatID, messageID string, userID int64) error {
+	if err := s.requireAdmin(ctx, chatID, userID); err != nil {
+		return err
+	}
+
+	if err := s.chatRepo.UnpinMessage(ctx, chatID, messageID); err != nil {
+		return err
+	}
+
+	s.publishEvent(ctx, EventMessagePinned, chatID, models.MessagePinned{
+		ChatID:    chatID,
+		MessageID: messageID,
+		Pinned:    false,
+		ChangedBy: userID,
+		ChangedAt: time.Now(),
+	})
+
+	return nil
+}
+
+func (s *ChatService) GetPinnedMessages(ctx context.Context, chatID string, userID int64) ([]chat.PinnedMessage, error) {
+	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrPermissionDenied
+	}
+
+	return s.chatRepo.GetPinnedMessages(ctx, chatID)
+}
+
+// requireNotBlocked stops userID from posting to a direct chat whose other
+// member blocked them. In group chats blocks only affect delivery.
+func (s *ChatService) requireNotBlocked(ctx context.Context, chatID string, userID int64) error {
+	blocked, err := s.chatRepo.IsBlockedInDirectChat(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrBlocked
+	}
+	return nil
+}
+
+func (s *ChatService) requireAdmin(ctx context.Context, chatID string, userID int64) error {
+	isAdmin, err := s.chatRepo.IsAdmin(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+func (s *ChatService) GetMentions(ctx context.Context, userID int64, unreadOnly bool, pageSize int, pageToken string) ([]chat.MentionedMessage, string, error) {
+	var after *chat.MessageCursor
+	if pageToken != "" {
+		cursor, err := decodeMessageCursor(pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		after = cursor
+	}
+
+	if pageSize <= 0 {
+		pageSize = defaultMentionsPageSize
+	}
+	if pageSize > maxMentionsPageSize {
+		pageSize = maxMentionsPageSize
+	}
+
+	mentioned, err := s.chatRepo.GetMentions(ctx, userID, unreadOnly, after, pageSize+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextPageToken string
+	if len(mentioned) > pageSize {
+		mentioned = mentioned[:pageSize]
+		last := mentioned[len(mentioned)-1].Message
+		nextPageToken = encodeMessageCursor(chat.MessageCursor{SentAt: last.SentAt, ID: last.ID})
+	}
+
+	return mentioned, nextPageToken, nil
+}
+
+func (s *ChatService) MarkMentionsRead(ctx context.Context, chatID string, userID int64) error {
+	return s.chatRepo.MarkMentionsRead(ctx, userID, chatID)
+}
+
+// ForwardMessages copies messages from one chat into another. Formatting and
+// link previews are kept, mentions are not: they refer to members of the
+// source chat.
+func (s *ChatService) ForwardMessages(ctx context.Context, fromChatID string, messageIDs []string, toChatID string, userID int64) ([]models.Message, error) {
+	messageIDs = uniqueStrings(messageIDs)
+	if len(messageIDs) == 0 {
+		return nil, ErrNothingToForward
+	}
+	if len(messageIDs) > maxForwardMessages {
+		return nil, ErrTooManyToForward
+	}
+
+	for _, chatID := range []string{fromChatID, toChatID} {
+		isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !isMember {
+			return nil, ErrPermissionDenied
+		}
+	}
+
+	if err := s.requireNotBlocked(ctx, toChatID, userID); err != nil {
+		return nil, err
+	}
+
+	sources, err := s.chatRepo.GetForwardSources(ctx, fromChatID, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) != len(messageIDs) {
+		return nil, ErrMessageNotFound
+	}
+
+	// Forwarded text is screened as if the user had typed it into toChatID.
+	copies := make([]chat.NewMessage, 0, len(sources))
+	screened := make([]filter.Message, 0, len(sources))
+	verdicts := make([]filter.Result, 0, len(sources))
+	for _, src := range sources {
+		var formatting []models.Entity
+		for _, e := range src.Message.Entities {
+			if e.Type != models.EntityMention {
+				formatting = append(formatting, e)
+			}
+		}
+
+		filterMsg := filter.Message{ChatID: toChatID, SenderID: userID, Text: src.Message.Text, Entities: formatting}
+		verdict, err := s.screen(ctx, filterMsg)
+		if err != nil {
+			return nil, err
+		}
+		screened = append(screened, filterMsg)
+		verdicts = append(verdicts, verdict)
+
+		forwardedFrom := src.Message.ForwardedFrom
+		if forwardedFrom == nil {
+			forwardedFrom = &models.ForwardedFrom{
+				ChatID:       src.Message.ChatID,
+				MessageID:    src.Message.ID,
+				SenderID:     src.Message.SenderID,
+				SenderHidden: src.SenderHidden,
+				SentAt:       src.Message.SentAt,
+			}
+			if src.SenderHidden {
+				forwardedFrom.SenderID = 0
+			}
+		}
+
+		copies = append(copies, chat.NewMessage{
+			ChatID:        toChatID,
+			SenderID:      userID,
+			Text:          verdict.Text,
+			Entities:      formatting,
+			LinkPreview:   src.Message.LinkPreview,
+			ForwardedFrom: forwardedFrom,
+			Events: messageEvents(models.Message{
+				ChatID:        toChatID,
+				SenderID:      userID,
+				Text:          verdict.Text,
+				Entities:      formatting,
+				LinkPreview:   src.Message.LinkPreview,
+				ForwardedFrom: forwardedFrom,
+			}),
+		})
+	}
+
+	sent, err := s.chatRepo.SendMessages(ctx, copies)
+	if err != nil {
+		return nil, err
+	}
+	s.wakeRelay()
+	s.filters.Track(ctx, screened...)
+
+	messages := make([]models.Message, 0, len(sent))
+	for i, sm := range sent {
+		s.filters.Record(ctx, screened[i], verdicts[i], sm.ID)
+		msg := models.Message{
+			ID:            sm.ID,
+			ChatID:        toChatID,
+			SenderID:      userID,
+			Text:          copies[i].Text,
+			SentAt:        sm.SentAt,
+			Entities:      copies[i].Entities,
+			LinkPreview:   copies[i].LinkPreview,
+			ForwardedFrom: copies[i].ForwardedFrom,
+			ExpiresAt:     sm.ExpiresAt,
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var list []string
+	for _, v := range values {
+		if v != "" && !seen[v] {
+			seen[v] = true
+			list = append(list, v)
+		}
+	}
+	return list
 }
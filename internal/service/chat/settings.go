@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/models"
+	"github.com/christmas-fire/nexus/internal/repository/chat"
+)
+
+var (
+	ErrInvalidMuteTime    = errors.New("mute time must be in the future")
+	ErrTooManyPinnedChats = errors.New("too many pinned chats")
+)
+
+const (
+	EventChatSettingsUpdated = "chat_settings_updated"
+
+	maxPinnedChats = 10
+)
+
+// UpdateChatSettings changes the user's own settings for a chat and syncs
+// them to the user's sessions.
+func (s *ChatService) UpdateChatSettings(ctx context.Context, chatID string, userID int64, update chat.ChatSettingsUpdate) (models.ChatSettings, error) {
+	if !update.Unmute && update.MutedUntil != nil && !update.MutedUntil.After(time.Now()) {
+		return models.ChatSettings{}, ErrInvalidMuteTime
+	}
+
+	if update.Pinned != nil && *update.Pinned {
+		pinned, err := s.chatRepo.CountPinnedChats(ctx, userID, chatID)
+		if err != nil {
+			return models.ChatSettings{}, err
+		}
+		if pinned >= maxPinnedChats {
+			return models.ChatSettings{}, ErrTooManyPinnedChats
+		}
+	}
+
+	settings, err := s.chatRepo.UpdateChatSettings(ctx, chatID, userID, update)
+	if err != nil {
+		if errors.Is(err, chat.ErrNotMember) {
+			return models.ChatSettings{}, ErrPermissionDenied
+		}
+		return models.ChatSettings{}, err
+	}
+
+	s.publishUserEvent(ctx, EventChatSettingsUpdated, chatID, []int64{userID}, settings)
+	return settings, nil
+}
@@ -0,0 +1,100 @@
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/models"
+)
+
+// retryDelay is how long a bus waits after an error before trying again.
+const retryDelay = time.Second
+
+// Handler processes an event taken off the bus. An event whose handler
+// fails is delivered again later.
+type Handler func(ctx context.Context, event models.Event) error
+
+// EventBus carries events from the services to the WebSocket hubs. A bus
+// that implements Router delivers a hub only the events of the users it
+// watches; any other bus delivers every event to every hub.
+type EventBus interface {
+	Publish(ctx context.Context, event models.Event) error
+	// Subscribe passes events to handler until ctx is done.
+	Subscribe(ctx context.Context, handler Handler) error
+}
+
+// MemoryBus is an EventBus within a single process, for tests and
+// single-instance setups. Events published while nobody is subscribed are
+// dropped.
+type MemoryBus struct {
+	mu     sync.Mutex
+	subs   map[*memorySubscriber]bool
+	buffer int
+}
+
+type memorySubscriber struct {
+	events chan models.Event
+	done   chan struct{}
+}
+
+func NewMemoryBus(buffer int) *MemoryBus {
+	return &MemoryBus{subs: make(map[*memorySubscriber]bool), buffer: buffer}
+}
+
+// Publish blocks until every subscriber has room for the event.
+func (b *MemoryBus) Publish(ctx context.Context, event models.Event) error {
+	b.mu.Lock()
+	subs := make([]*memorySubscriber, 0, len(b.subs))
+	for sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		select {
+		case sub.events <- event:
+		case <-sub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Subscribe retries an event whose handler fails until it succeeds or ctx
+// is done.
+func (b *MemoryBus) Subscribe(ctx context.Context, handler Handler) error {
+	sub := &memorySubscriber{events: make(chan models.Event, b.buffer), done: make(chan struct{})}
+	b.mu.Lock()
+	b.subs[sub] = true
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.subs, sub)
+		b.mu.Unlock()
+		close(sub.done)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-sub.events:
+			for {
+				err := handler(ctx, event)
+				if err == nil {
+					break
+				}
+				log.Printf("failed to handle %s event, retrying: %v", event.Type, err)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(retryDelay):
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrResyncRequired is returned when the events a client missed are no
+// longer in the journal, so it has to reload its state instead.
+var ErrResyncRequired = errors.New("missed events are no longer available")
+
+const (
+	seqKeyPrefix = "events:seq:"
+	logKeyPrefix = "events:log:"
+)
+
+// appendScript takes the next sequence number of a user and stores the event
+// in the user's stream under the ID "<seq>-0", so that stream IDs and
+// sequence numbers are the same thing. If the stream holds IDs above the
+// counter, which happens only if the counter was lost, the stream is dropped
+// and started over.
+var appendScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[1])
+local id = seq .. '-0'
+local res = redis.pcall('XADD', KEYS[2], 'MAXLEN', '~', ARGV[1], id, 'event', ARGV[2])
+if type(res) == 'table' and res.err then
+	redis.call('DEL', KEYS[2])
+	redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[1], id, 'event', ARGV[2])
+end
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+return seq
+`)
+
+type JournalOptions struct {
+	// MaxLen is roughly how many events are kept per user.
+	MaxLen int64
+	// Retention is how long a user's events are kept after the last one.
+	Retention time.Duration
+}
+
+// Entry is an event as stored in a user's journal.
+type Entry struct {
+	Seq     int64           `json:"-"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Journal numbers the events delivered to each user and keeps the recent
+// ones, so that a client that lost its connection can be sent what it
+// missed. Sequence numbers start at 1 and grow by one with every event
+// addressed to the user, across all of their sessions.
+type Journal struct {
+	redis *redis.Client
+	opts  JournalOptions
+}
+
+func NewJournal(redisClient *redis.Client, opts JournalOptions) *Journal {
+	if opts.MaxLen <= 0 {
+		opts.MaxLen = 1000
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = 24 * time.Hour
+	}
+	return &Journal{redis: redisClient, opts: opts}
+}
+
+func seqKey(userID int64) string {
+	return seqKeyPrefix + strconv.FormatInt(userID, 10)
+}
+
+func logKey(userID int64) string {
+	return logKeyPrefix + strconv.FormatInt(userID, 10)
+}
+
+// Append records an event for every user in userIDs and returns the
+// sequence number it got for each of them.
+func (j *Journal) Append(ctx context.Context, userIDs []int64, entry Entry) (map[int64]int64, error) {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal journal entry: %w", err)
+	}
+
+	cmds := make([]*redis.Cmd, len(userIDs))
+	_, err = j.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, userID := range userIDs {
+			keys := []string{seqKey(userID), logKey(userID)}
+			cmds[i] = appendScript.Run(ctx, pipe, keys, j.opts.MaxLen, entryBytes, j.opts.Retention.Milliseconds())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to append to journal: %w", err)
+	}
+
+	seqs := make(map[int64]int64, len(userIDs))
+	for i, userID := range userIDs {
+		seq, err := cmds[i].Int64()
+		if err != nil {
+			return nil, fmt.Errorf("failed to append to journal of user %d: %w", userID, err)
+		}
+		seqs[userID] = seq
+	}
+	return seqs, nil
+}
+
+// Latest returns the sequence number of the last event addressed to
+// userID, or 0 if there has been none.
+func (j *Journal) Latest(ctx context.Context, userID int64) (int64, error) {
+	seq, err := j.redis.Get(ctx, seqKey(userID)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, fmt.Errorf("failed to get latest sequence number: %w", err)
+	}
+	return seq, nil
+}
+
+// Since returns the events of userID after sequence number after, oldest
+// first, together with the latest sequence number. It returns
+// ErrResyncRequired, along with the latest sequence number, when some of
+// those events were trimmed away or there are more than limit of them.
+func (j *Journal) Since(ctx context.Context, userID, after int64, limit int) ([]Entry, int64, error) {
+	latest, err := j.Latest(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case after == latest:
+		return nil, latest, nil
+	case after < 0 || after > latest || latest-after > int64(limit):
+		return nil, latest, ErrResyncRequired
+	}
+
+	start := strconv.FormatInt(after+1, 10) + "-0"
+	end := strconv.FormatInt(latest, 10) + "-0"
+	msgs, err := j.redis.XRange(ctx, logKey(userID), start, end).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read journal: %w", err)
+	}
+	if len(msgs) == 0 || msgs[0].ID != start {
+		return nil, latest, ErrResyncRequired
+	}
+
+	entries := make([]Entry, 0, len(msgs))
+	for _, msg := range msgs {
+		seqPart, _, _ := strings.Cut(msg.ID, "-")
+		seq, err := strconv.ParseInt(seqPart, 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid journal entry id %q: %w", msg.ID, err)
+		}
+		raw, _ := msg.Values["event"].(string)
+
+		var entry Entry
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			return nil, 0, fmt.Errorf("failed to unmarshal journal entry %s: %w", msg.ID, err)
+		}
+		entry.Seq = seq
+		entries = append(entries, entry)
+	}
+
+	// Entries must follow each other without a hole, or events were lost
+	// when the stream was started over.
+	for i, entry := range entries {
+		if entry.Seq != after+1+int64(i) {
+			return nil, latest, ErrResyncRequired
+		}
+	}
+
+	return entries, entries[len(entries)-1].Seq, nil
+}
@@ -0,0 +1,181 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	membersKeyPrefix      = "members:"
+	membersGenKeyPrefix   = "members:gen:"
+	membersChangedChannel = "members:changed"
+)
+
+type MembershipOptions struct {
+	// TTL is how long members are cached in Redis.
+	TTL time.Duration
+	// LocalTTL is how long members are cached in memory. It bounds how
+	// stale an instance gets if it misses an invalidation.
+	LocalTTL time.Duration
+	// MaxLocalChats is how many chats are cached in memory.
+	MaxLocalChats int
+}
+
+// MembershipCache is an Audience that caches chat members in memory and in
+// Redis in front of another Audience. Blockers are not cached.
+//
+// Members are cached in Redis under the chat's generation, which
+// InvalidateChat increments, so a lookup that read the members before an
+// invalidation cannot cache them over it. The memory cache is guarded the
+// same way by epoch.
+type MembershipCache struct {
+	next  Audience
+	redis *redis.Client
+	opts  MembershipOptions
+
+	mu    sync.RWMutex
+	local map[string]cachedMembers
+	// epoch counts invalidations seen by this instance.
+	epoch uint64
+}
+
+type cachedMembers struct {
+	userIDs []int64
+	expires time.Time
+}
+
+func NewMembershipCache(redisClient *redis.Client, next Audience, opts MembershipOptions) *MembershipCache {
+	if opts.TTL <= 0 {
+		opts.TTL = 10 * time.Minute
+	}
+	if opts.LocalTTL <= 0 {
+		opts.LocalTTL = 30 * time.Second
+	}
+	if opts.MaxLocalChats <= 0 {
+		opts.MaxLocalChats = 100000
+	}
+	return &MembershipCache{
+		next:  next,
+		redis: redisClient,
+		opts:  opts,
+		local: make(map[string]cachedMembers),
+	}
+}
+
+// GetChatMemberIDs returns the members of a chat. The slice is shared and
+// must not be modified.
+func (c *MembershipCache) GetChatMemberIDs(ctx context.Context, chatID string) ([]int64, error) {
+	now := time.Now()
+
+	c.mu.RLock()
+	cached, ok := c.local[chatID]
+	epoch := c.epoch
+	c.mu.RUnlock()
+	if ok && now.Before(cached.expires) {
+		return cached.userIDs, nil
+	}
+
+	gen, err := c.redis.Get(ctx, membersGenKeyPrefix+chatID).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		// Without the generation the Redis cache cannot be trusted.
+		log.Printf("failed to read members generation of chat %s: %v", chatID, err)
+		return c.next.GetChatMemberIDs(ctx, chatID)
+	}
+
+	key := membersKeyPrefix + chatID + ":" + strconv.FormatInt(gen, 10)
+	raw, err := c.redis.Get(ctx, key).Bytes()
+	if err == nil {
+		var userIDs []int64
+		if err := json.Unmarshal(raw, &userIDs); err == nil {
+			c.store(chatID, userIDs, epoch, now)
+			return userIDs, nil
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		log.Printf("failed to read cached members of chat %s: %v", chatID, err)
+	}
+
+	userIDs, err := c.next.GetChatMemberIDs(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if raw, err := json.Marshal(userIDs); err == nil {
+		if err := c.redis.Set(ctx, key, raw, c.opts.TTL).Err(); err != nil {
+			log.Printf("failed to cache members of chat %s: %v", chatID, err)
+		}
+	}
+	c.store(chatID, userIDs, epoch, now)
+	return userIDs, nil
+}
+
+func (c *MembershipCache) GetBlockerIDs(ctx context.Context, userID int64) ([]int64, error) {
+	return c.next.GetBlockerIDs(ctx, userID)
+}
+
+// store caches userIDs in memory unless a chat was invalidated since epoch
+// was read.
+func (c *MembershipCache) store(chatID string, userIDs []int64, epoch uint64, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.epoch != epoch {
+		return
+	}
+
+	if len(c.local) >= c.opts.MaxLocalChats {
+		for id, cached := range c.local {
+			if !now.Before(cached.expires) {
+				delete(c.local, id)
+			}
+		}
+		if len(c.local) >= c.opts.MaxLocalChats {
+			clear(c.local)
+		}
+	}
+	c.local[chatID] = cachedMembers{userIDs: userIDs, expires: now.Add(c.opts.LocalTTL)}
+}
+
+// InvalidateChat drops the cached members of a chat, on every instance.
+// The generation outlives every copy cached under an earlier one, so it
+// never goes back to a generation that still has members cached.
+func (c *MembershipCache) InvalidateChat(ctx context.Context, chatID string) error {
+	c.forget(chatID)
+	genKey := membersGenKeyPrefix + chatID
+	_, err := c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, genKey)
+		pipe.Expire(ctx, genKey, 2*c.opts.TTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to drop cached members of chat %s: %w", chatID, err)
+	}
+	if err := c.redis.Publish(ctx, membersChangedChannel, chatID).Err(); err != nil {
+		return fmt.Errorf("failed to announce member change of chat %s: %w", chatID, err)
+	}
+	return nil
+}
+
+// Run drops chats from the memory cache as other instances invalidate
+// them, until ctx is done.
+func (c *MembershipCache) Run(ctx context.Context) {
+	pubsub := c.redis.Subscribe(ctx, membersChangedChannel)
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		c.forget(msg.Payload)
+	}
+}
+
+func (c *MembershipCache) forget(chatID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.local, chatID)
+	c.epoch++
+}
@@ -0,0 +1,139 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/christmas-fire/nexus/internal/models"
+)
+
+// Audience looks up who an event is for.
+type Audience interface {
+	GetChatMemberIDs(ctx context.Context, chatID string) ([]int64, error)
+	GetBlockerIDs(ctx context.Context, userID int64) ([]int64, error)
+}
+
+// Invalidator is implemented by an Audience that caches chat members.
+type Invalidator interface {
+	InvalidateChat(ctx context.Context, chatID string) error
+}
+
+// Publisher resolves the recipients of events, numbers them in the journal
+// and publishes them on the bus to the hubs. The event it publishes lists
+// every recipient in UserIDs and their sequence numbers in Seqs.
+type Publisher struct {
+	bus      EventBus
+	audience Audience
+	journal  *Journal
+}
+
+func NewPublisher(bus EventBus, audience Audience, journal *Journal) *Publisher {
+	return &Publisher{bus: bus, audience: audience, journal: journal}
+}
+
+// Encode sets the payload of event.
+func Encode(event models.Event, payload interface{}) (models.Event, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return models.Event{}, fmt.Errorf("failed to marshal %s payload: %w", event.Type, err)
+	}
+	event.Payload = payloadBytes
+	return event, nil
+}
+
+// Publish delivers an event with the given payload right away. Failures are
+// only logged: the change the event is about is already persisted. If the
+// journal is unavailable the event still goes out, without sequence
+// numbers. Events that must not be lost go through the outbox instead.
+func (p *Publisher) Publish(ctx context.Context, event models.Event, payload interface{}) {
+	encoded, err := Encode(event, payload)
+	if err == nil {
+		err = p.deliver(ctx, encoded, false)
+	}
+	if err != nil {
+		log.Printf("failed to publish %s event: %v", event.Type, err)
+	}
+}
+
+// Deliver journals an encoded event for its recipients and publishes it.
+// An event that is delivered again after a failure may reach some
+// recipients twice, under new sequence numbers. Concurrent deliveries may
+// reach the bus out of sequence order; the hubs restore it from the
+// journal.
+func (p *Publisher) Deliver(ctx context.Context, event models.Event) error {
+	return p.deliver(ctx, event, true)
+}
+
+// deliver fails if the event cannot be journaled when requireSeqs is set.
+func (p *Publisher) deliver(ctx context.Context, event models.Event, requireSeqs bool) error {
+	recipients, err := p.recipients(ctx, event)
+	if err != nil {
+		return fmt.Errorf("failed to resolve recipients: %w", err)
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+	event.UserIDs = recipients
+
+	seqs, err := p.journal.Append(ctx, recipients, Entry{Type: event.Type, Payload: event.Payload})
+	if err != nil {
+		if requireSeqs {
+			return err
+		}
+		log.Printf("failed to journal %s event, publishing it without sequence numbers: %v", event.Type, err)
+	}
+	event.Seqs = seqs
+
+	return p.bus.Publish(ctx, event)
+}
+
+// MembersChanged must be called once the members of a chat have changed,
+// after the change is committed. Members are only set when a chat is
+// created; a path that adds or removes members later must call it too.
+func (p *Publisher) MembersChanged(ctx context.Context, chatID string) {
+	inv, ok := p.audience.(Invalidator)
+	if !ok {
+		return
+	}
+	if err := inv.InvalidateChat(ctx, chatID); err != nil {
+		log.Printf("failed to invalidate members of chat %s: %v", chatID, err)
+	}
+}
+
+// recipients returns event.UserIDs, or the members of event.ChatID if it is
+// empty, leaving out users who blocked event.SenderID.
+func (p *Publisher) recipients(ctx context.Context, event models.Event) ([]int64, error) {
+	userIDs := event.UserIDs
+	if len(userIDs) == 0 {
+		var err error
+		userIDs, err = p.audience.GetChatMemberIDs(ctx, event.ChatID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if event.SenderID == 0 {
+		return userIDs, nil
+	}
+
+	blockerIDs, err := p.audience.GetBlockerIDs(ctx, event.SenderID)
+	if err != nil {
+		return nil, err
+	}
+	if len(blockerIDs) == 0 {
+		return userIDs, nil
+	}
+	blockers := make(map[int64]bool, len(blockerIDs))
+	for _, id := range blockerIDs {
+		blockers[id] = true
+	}
+
+	recipients := make([]int64, 0, len(userIDs))
+	for _, id := range userIDs {
+		if !blockers[id] {
+			recipients = append(recipients, id)
+		}
+	}
+	return recipients, nil
+}
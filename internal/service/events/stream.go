@@ -0,0 +1,246 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+type StreamOptions struct {
+	// Stream is the Redis stream events are appended to.
+	Stream string
+	// MaxLen is roughly how many events the stream keeps. A subscriber that
+	// is down for longer than it takes to publish that many misses events.
+	MaxLen int64
+	// Group is the consumer group of the subscriber. Every gateway instance
+	// needs a group of its own, and should keep it across restarts to pick
+	// up the events published while it was down.
+	Group string
+	// Consumer names the subscriber within its group.
+	Consumer string
+	// BatchSize is how many events are read at a time.
+	BatchSize int64
+	// Block is how long a read waits for new events.
+	Block time.Duration
+	// ClaimIdle is how long an event may go unacknowledged before it is
+	// handled again.
+	ClaimIdle time.Duration
+}
+
+// StreamBus is an EventBus on a Redis stream. Each subscriber reads through
+// its own consumer group and acknowledges the events it has handled;
+// unacknowledged events are picked up again, so delivery is at least once.
+type StreamBus struct {
+	redis *redis.Client
+	opts  StreamOptions
+}
+
+func NewStreamBus(redisClient *redis.Client, opts StreamOptions) *StreamBus {
+	if opts.Stream == "" {
+		opts.Stream = "events:bus"
+	}
+	if opts.MaxLen <= 0 {
+		opts.MaxLen = 100000
+	}
+	if opts.Consumer == "" {
+		opts.Consumer = "consumer"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Block <= 0 {
+		opts.Block = 5 * time.Second
+	}
+	if opts.ClaimIdle <= 0 {
+		opts.ClaimIdle = time.Minute
+	}
+	return &StreamBus{redis: redisClient, opts: opts}
+}
+
+func (b *StreamBus) Publish(ctx context.Context, event models.Event) error {
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", event.Type, err)
+	}
+
+	err = b.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: b.opts.Stream,
+		MaxLen: b.opts.MaxLen,
+		Approx: true,
+		Values: []any{"event", eventBytes},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", event.Type, err)
+	}
+	return nil
+}
+
+// Subscribe first handles the events delivered to this consumer before but
+// never acknowledged, then reads new ones, reclaiming those that stay
+// unacknowledged for ClaimIdle along the way.
+func (b *StreamBus) Subscribe(ctx context.Context, handler Handler) error {
+	if b.opts.Group == "" {
+		return errors.New("stream bus subscriber needs a consumer group")
+	}
+	if err := b.ensureGroup(ctx); err != nil {
+		return err
+	}
+
+	if err := b.recoverPending(ctx, handler); err != nil {
+		return err
+	}
+
+	lastClaim := time.Now()
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if time.Since(lastClaim) >= b.opts.ClaimIdle {
+			b.claimStale(ctx, handler)
+			lastClaim = time.Now()
+		}
+
+		streams, err := b.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    b.opts.Group,
+			Consumer: b.opts.Consumer,
+			Streams:  []string{b.opts.Stream, ">"},
+			Count:    b.opts.BatchSize,
+			Block:    b.opts.Block,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if !b.recover(ctx, err) {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			b.handle(ctx, stream.Messages, handler)
+		}
+	}
+}
+
+func (b *StreamBus) ensureGroup(ctx context.Context) error {
+	err := b.redis.XGroupCreateMkStream(ctx, b.opts.Stream, b.opts.Group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group %s: %w", b.opts.Group, err)
+	}
+	return nil
+}
+
+// recover deals with a failed read: the group is created again if it is
+// gone, otherwise the read is retried after a pause. It reports false when
+// ctx is done.
+func (b *StreamBus) recover(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if strings.HasPrefix(err.Error(), "NOGROUP") {
+		if err := b.ensureGroup(ctx); err == nil {
+			return true
+		}
+	}
+	log.Printf("failed to read events from %s: %v", b.opts.Stream, err)
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(retryDelay):
+		return true
+	}
+}
+
+// recoverPending goes once through the events this consumer was given but
+// did not acknowledge, typically because it was stopped.
+func (b *StreamBus) recoverPending(ctx context.Context, handler Handler) error {
+	start := "0"
+	for {
+		streams, err := b.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    b.opts.Group,
+			Consumer: b.opts.Consumer,
+			Streams:  []string{b.opts.Stream, start},
+			Count:    b.opts.BatchSize,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return nil
+			}
+			return fmt.Errorf("failed to read pending events: %w", err)
+		}
+		if len(streams) == 0 || len(streams[0].Messages) == 0 {
+			return nil
+		}
+
+		messages := streams[0].Messages
+		b.handle(ctx, messages, handler)
+		start = messages[len(messages)-1].ID
+	}
+}
+
+// claimStale takes over events of the group that have been left
+// unacknowledged for ClaimIdle, whether by this consumer or another one of
+// the group that went away, and handles them again.
+func (b *StreamBus) claimStale(ctx context.Context, handler Handler) {
+	start := "0-0"
+	for {
+		messages, next, err := b.redis.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   b.opts.Stream,
+			Group:    b.opts.Group,
+			Consumer: b.opts.Consumer,
+			MinIdle:  b.opts.ClaimIdle,
+			Start:    start,
+			Count:    b.opts.BatchSize,
+		}).Result()
+		if err != nil {
+			log.Printf("failed to claim stale events from %s: %v", b.opts.Stream, err)
+			return
+		}
+
+		b.handle(ctx, messages, handler)
+		if next == "0-0" {
+			return
+		}
+		start = next
+	}
+}
+
+// handle passes messages to handler and acknowledges those it handled.
+// Malformed events are acknowledged and dropped, since no retry can fix
+// them.
+func (b *StreamBus) handle(ctx context.Context, messages []redis.XMessage, handler Handler) {
+	acked := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		raw, _ := msg.Values["event"].(string)
+
+		var event models.Event
+		if err := json.Unmarshal([]byte(raw), &event); err != nil {
+			log.Printf("failed to unmarshal event %s from %s: %v", msg.ID, b.opts.Stream, err)
+			acked = append(acked, msg.ID)
+			continue
+		}
+
+		if err := handler(ctx, event); err != nil {
+			log.Printf("failed to handle %s event %s, leaving it for retry: %v", event.Type, msg.ID, err)
+			continue
+		}
+		acked = append(acked, msg.ID)
+	}
+
+	if len(acked) == 0 {
+		return
+	}
+	if err := b.redis.XAck(ctx, b.opts.Stream, b.opts.Group, acked...).Err(); err != nil {
+		log.Printf("failed to acknowledge events on %s: %v", b.opts.Stream, err)
+	}
+}
@@ -0,0 +1,143 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/christmas-fire/nexus/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+const userChannelPrefix = "events:user:"
+
+// Router is implemented by buses that only deliver to a subscriber the
+// events of users it has asked for. Watch and Unwatch calls are counted, so
+// every session of a user can watch it independently.
+type Router interface {
+	Watch(ctx context.Context, userID int64) error
+	Unwatch(ctx context.Context, userID int64) error
+}
+
+// UserChannelBus is an EventBus that publishes an event to a Redis channel
+// per recipient, so that a gateway only receives the events of the users
+// connected to it. Delivery is at most once: Pub/Sub does not keep events
+// for gateways that are down or restarting, and an event whose handler
+// fails is not retried. Clients catch up from the journal when they
+// reconnect.
+type UserChannelBus struct {
+	redis  *redis.Client
+	pubsub *redis.PubSub
+
+	// mu serializes subscription changes and guards watchers.
+	mu       sync.Mutex
+	watchers map[int64]int
+}
+
+func NewUserChannelBus(redisClient *redis.Client) *UserChannelBus {
+	return &UserChannelBus{
+		redis:    redisClient,
+		pubsub:   redisClient.Subscribe(context.Background()),
+		watchers: make(map[int64]int),
+	}
+}
+
+func userChannel(userID int64) string {
+	return userChannelPrefix + strconv.FormatInt(userID, 10)
+}
+
+// Publish sends every recipient a copy of the event addressed to them
+// alone.
+func (b *UserChannelBus) Publish(ctx context.Context, event models.Event) error {
+	_, err := b.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, userID := range event.UserIDs {
+			single := event
+			single.UserIDs = []int64{userID}
+			single.Seqs = nil
+			if seq, ok := event.Seqs[userID]; ok {
+				single.Seqs = map[int64]int64{userID: seq}
+			}
+
+			eventBytes, err := json.Marshal(single)
+			if err != nil {
+				return fmt.Errorf("failed to marshal %s event: %w", event.Type, err)
+			}
+			pipe.Publish(ctx, userChannel(userID), eventBytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", event.Type, err)
+	}
+	return nil
+}
+
+// Subscribe passes on the events of the watched users. Events whose
+// handler fails are not retried.
+func (b *UserChannelBus) Subscribe(ctx context.Context, handler Handler) error {
+	ch := b.pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if !strings.HasPrefix(msg.Channel, userChannelPrefix) {
+				continue
+			}
+
+			var event models.Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				log.Printf("failed to unmarshal event from %s: %v", msg.Channel, err)
+				continue
+			}
+			if err := handler(ctx, event); err != nil {
+				log.Printf("failed to handle %s event from %s: %v", event.Type, msg.Channel, err)
+			}
+		}
+	}
+}
+
+func (b *UserChannelBus) Watch(ctx context.Context, userID int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.watchers[userID] == 0 {
+		if err := b.pubsub.Subscribe(ctx, userChannel(userID)); err != nil {
+			return fmt.Errorf("failed to subscribe to events of user %d: %w", userID, err)
+		}
+	}
+	b.watchers[userID]++
+	return nil
+}
+
+func (b *UserChannelBus) Unwatch(ctx context.Context, userID int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.watchers[userID] {
+	case 0:
+		return nil
+	case 1:
+		// Should unsubscribing fail, the user stays watched: a channel
+		// left subscribed costs less than one dropped too early.
+		if err := b.pubsub.Unsubscribe(ctx, userChannel(userID)); err != nil {
+			return fmt.Errorf("failed to unsubscribe from events of user %d: %w", userID, err)
+		}
+		delete(b.watchers, userID)
+	default:
+		b.watchers[userID]--
+	}
+	return nil
+}
+
+// Close ends the subscription of this bus.
+func (b *UserChannelBus) Close() error {
+	return b.pubsub.Close()
+}
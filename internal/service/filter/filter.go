@@ -0,0 +1,207 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"unicode/utf8"
+
+	"github.com/christmas-fire/nexus/internal/models"
+)
+
+var (
+	ErrRejected      = errors.New("message rejected by content filter")
+	ErrInvalidAction = errors.New("invalid filter action")
+)
+
+// Action is what a filter does with a message it objects to.
+type Action int
+
+const (
+	Allow Action = iota
+	// Flag lets the message through and records it for moderators.
+	Flag
+	// Mask replaces the offending parts of the text with asterisks.
+	Mask
+	// Reject refuses the message.
+	Reject
+)
+
+func (a Action) String() string {
+	switch a {
+	case Allow:
+		return "allow"
+	case Flag:
+		return "flag"
+	case Mask:
+		return "mask"
+	case Reject:
+		return "reject"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+func ParseAction(s string) (Action, error) {
+	switch s {
+	case "flag":
+		return Flag, nil
+	case "mask":
+		return Mask, nil
+	case "reject":
+		return Reject, nil
+	}
+	return Allow, fmt.Errorf("%w: %q", ErrInvalidAction, s)
+}
+
+// Message is the sanitized message a filter inspects.
+type Message struct {
+	ChatID   string
+	SenderID int64
+	Text     string
+	Entities []models.Entity
+}
+
+// Decision is a filter's verdict on a message. A Mask decision carries the
+// masked text, which must have as many runes as the input so that entity
+// offsets stay valid.
+type Decision struct {
+	Filter string
+	Action Action
+	Reason string
+	Text   string
+}
+
+type MessageFilter interface {
+	Name() string
+	Check(ctx context.Context, msg Message) (Decision, error)
+}
+
+// Tracker is implemented by a filter that keeps count of what a user has
+// sent. Check must not count; Track is told about the messages of one send,
+// as they were passed to Run, once the whole pipeline accepted and stored
+// them.
+type Tracker interface {
+	Track(ctx context.Context, msgs []Message) error
+}
+
+// DecisionLog stores filter decisions for moderators.
+type DecisionLog interface {
+	LogFilterDecisions(ctx context.Context, decisions []models.FilterDecision) error
+}
+
+// Result is the outcome of running a message through a Pipeline.
+type Result struct {
+	// Text is the message text after masking.
+	Text string
+	// Decisions holds every decision other than Allow, in filter order.
+	Decisions []Decision
+	// Rejected is set when a filter rejected the message; its decision is
+	// the last one in Decisions.
+	Rejected bool
+}
+
+// Reason is why the message was rejected.
+func (r Result) Reason() string {
+	if !r.Rejected {
+		return ""
+	}
+	return r.Decisions[len(r.Decisions)-1].Reason
+}
+
+// Pipeline runs a message through filters in order. Each filter sees the
+// text as masked by the ones before it, and the first rejection stops the
+// chain. A filter that fails is skipped, so an outage of, say, Redis does
+// not stop people from chatting.
+type Pipeline struct {
+	filters []MessageFilter
+	log     DecisionLog
+}
+
+func NewPipeline(log DecisionLog, filters ...MessageFilter) *Pipeline {
+	return &Pipeline{filters: filters, log: log}
+}
+
+// Run checks msg. A nil Pipeline lets every message through unchanged.
+func (p *Pipeline) Run(ctx context.Context, msg Message) Result {
+	result := Result{Text: msg.Text}
+	if p == nil {
+		return result
+	}
+
+	for _, f := range p.filters {
+		msg.Text = result.Text
+		decision, err := f.Check(ctx, msg)
+		if err != nil {
+			log.Printf("content filter %s failed, skipping it: %v", f.Name(), err)
+			continue
+		}
+		if decision.Action == Allow {
+			continue
+		}
+		decision.Filter = f.Name()
+
+		if decision.Action == Mask {
+			if utf8.RuneCountInString(decision.Text) != utf8.RuneCountInString(result.Text) {
+				log.Printf("content filter %s changed the text length while masking, skipping it", f.Name())
+				continue
+			}
+			result.Text = decision.Text
+		}
+
+		result.Decisions = append(result.Decisions, decision)
+		if decision.Action == Reject {
+			result.Rejected = true
+			break
+		}
+	}
+
+	return result
+}
+
+// Track tells the filters that count what users send about the messages of
+// one send, such as a batch of forwarded messages, after they were stored.
+// Failures are only logged.
+func (p *Pipeline) Track(ctx context.Context, msgs ...Message) {
+	if p == nil || len(msgs) == 0 {
+		return
+	}
+	for _, f := range p.filters {
+		if t, ok := f.(Tracker); ok {
+			if err := t.Track(ctx, msgs); err != nil {
+				log.Printf("content filter %s failed to track messages: %v", f.Name(), err)
+			}
+		}
+	}
+}
+
+// Record stores the decisions in result for moderators. msg is the message
+// as it was passed to Run, and messageID the stored message, or empty if it
+// was rejected. Failures are only logged.
+func (p *Pipeline) Record(ctx context.Context, msg Message, result Result, messageID string) {
+	if p == nil || p.log == nil || len(result.Decisions) == 0 {
+		return
+	}
+
+	var storedID *string
+	if messageID != "" {
+		storedID = &messageID
+	}
+
+	decisions := make([]models.FilterDecision, 0, len(result.Decisions))
+	for _, d := range result.Decisions {
+		decisions = append(decisions, models.FilterDecision{
+			ChatID:    msg.ChatID,
+			SenderID:  msg.SenderID,
+			MessageID: storedID,
+			Filter:    d.Filter,
+			Action:    d.Action.String(),
+			Reason:    d.Reason,
+			Text:      msg.Text,
+		})
+	}
+
+	if err := p.log.LogFilterDecisions(ctx, decisions); err != nil {
+		log.Printf("failed to log content filter decisions for user %d: %v", msg.SenderID, err)
+	}
+}
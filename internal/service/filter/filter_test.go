@@ -0,0 +1,262 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/christmas-fire/nexus/internal/models"
+)
+
+// stubFilter returns a fixed decision and remembers the text it was given.
+type stubFilter struct {
+	name     string
+	decision Decision
+	err      error
+	seen     string
+}
+
+func (f *stubFilter) Name() string { return f.name }
+
+func (f *stubFilter) Check(ctx context.Context, msg Message) (Decision, error) {
+	f.seen = msg.Text
+	return f.decision, f.err
+}
+
+type decisionRecorder struct {
+	decisions []models.FilterDecision
+}
+
+func (r *decisionRecorder) LogFilterDecisions(ctx context.Context, decisions []models.FilterDecision) error {
+	r.decisions = append(r.decisions, decisions...)
+	return nil
+}
+
+func TestPipelineRun(t *testing.T) {
+	tests := []struct {
+		name         string
+		decisions    []Decision
+		err          error
+		wantText     string
+		wantRejected bool
+		wantActions  []Action
+		wantSeen     []string
+	}{
+		{
+			name:      "allow",
+			decisions: []Decision{{Action: Allow}, {Action: Allow}},
+			wantText:  "hello world",
+			wantSeen:  []string{"hello world", "hello world"},
+		},
+		{
+			name:        "flag keeps going",
+			decisions:   []Decision{{Action: Flag, Reason: "suspicious"}, {Action: Allow}},
+			wantText:    "hello world",
+			wantActions: []Action{Flag},
+			wantSeen:    []string{"hello world", "hello world"},
+		},
+		{
+			name:        "mask is seen by later filters",
+			decisions:   []Decision{{Action: Mask, Text: "hello *****"}, {Action: Allow}},
+			wantText:    "hello *****",
+			wantActions: []Action{Mask},
+			wantSeen:    []string{"hello world", "hello *****"},
+		},
+		{
+			name:      "mask that changes the length is skipped",
+			decisions: []Decision{{Action: Mask, Text: "hello"}, {Action: Allow}},
+			wantText:  "hello world",
+			wantSeen:  []string{"hello world", "hello world"},
+		},
+		{
+			name:         "reject stops the chain",
+			decisions:    []Decision{{Action: Flag}, {Action: Reject, Reason: "spam"}, {Action: Allow}},
+			wantText:     "hello world",
+			wantRejected: true,
+			wantActions:  []Action{Flag, Reject},
+			wantSeen:     []string{"hello world", "hello world", ""},
+		},
+		{
+			name:      "failing filter is skipped",
+			decisions: []Decision{{Action: Reject}, {Action: Allow}},
+			err:       errors.New("redis is down"),
+			wantText:  "hello world",
+			wantSeen:  []string{"hello world", "hello world"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filters []MessageFilter
+			var stubs []*stubFilter
+			for i, d := range tt.decisions {
+				stub := &stubFilter{name: string(rune('a' + i)), decision: d}
+				if i == 0 {
+					stub.err = tt.err
+				}
+				stubs = append(stubs, stub)
+				filters = append(filters, stub)
+			}
+
+			result := NewPipeline(nil, filters...).Run(context.Background(), Message{Text: "hello world"})
+
+			if result.Text != tt.wantText {
+				t.Errorf("Text = %q, want %q", result.Text, tt.wantText)
+			}
+			if result.Rejected != tt.wantRejected {
+				t.Errorf("Rejected = %v, want %v", result.Rejected, tt.wantRejected)
+			}
+			var actions []Action
+			for _, d := range result.Decisions {
+				actions = append(actions, d.Action)
+			}
+			if !reflect.DeepEqual(actions, tt.wantActions) {
+				t.Errorf("actions = %v, want %v", actions, tt.wantActions)
+			}
+			for i, stub := range stubs {
+				if stub.seen != tt.wantSeen[i] {
+					t.Errorf("filter %d saw %q, want %q", i, stub.seen, tt.wantSeen[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPipelineRejectReason(t *testing.T) {
+	p := NewPipeline(nil, &stubFilter{name: "spam", decision: Decision{Action: Reject, Reason: "too many links"}})
+	result := p.Run(context.Background(), Message{Text: "hi"})
+	if got := result.Reason(); got != "too many links" {
+		t.Errorf("Reason() = %q", got)
+	}
+	if got := result.Decisions[0].Filter; got != "spam" {
+		t.Errorf("Filter = %q, want the filter's name", got)
+	}
+}
+
+func TestNilPipeline(t *testing.T) {
+	var p *Pipeline
+	ctx := context.Background()
+	msg := Message{Text: "hello"}
+
+	result := p.Run(ctx, msg)
+	if result.Text != "hello" || result.Rejected || len(result.Decisions) != 0 {
+		t.Errorf("Run() = %+v, want the message through unchanged", result)
+	}
+	p.Record(ctx, msg, Result{Decisions: []Decision{{Action: Flag}}}, "message")
+	p.Track(ctx, msg)
+}
+
+func TestPipelineRecord(t *testing.T) {
+	ctx := context.Background()
+	msg := Message{ChatID: "chat", SenderID: 7, Text: "hello"}
+
+	tests := []struct {
+		name          string
+		result        Result
+		messageID     string
+		wantDecisions int
+		wantStored    bool
+	}{
+		{name: "no decisions", result: Result{Text: "hello"}, messageID: "message"},
+		{name: "stored", result: Result{Decisions: []Decision{{Filter: "wordlist", Action: Flag}}}, messageID: "message", wantDecisions: 1, wantStored: true},
+		{name: "rejected", result: Result{Decisions: []Decision{{Filter: "spam", Action: Reject}}, Rejected: true}, wantDecisions: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &decisionRecorder{}
+			NewPipeline(log).Record(ctx, msg, tt.result, tt.messageID)
+
+			if len(log.decisions) != tt.wantDecisions {
+				t.Fatalf("logged %d decisions, want %d", len(log.decisions), tt.wantDecisions)
+			}
+			for _, d := range log.decisions {
+				if (d.MessageID != nil) != tt.wantStored {
+					t.Errorf("MessageID = %v, want stored %v", d.MessageID, tt.wantStored)
+				}
+				if d.ChatID != msg.ChatID || d.SenderID != msg.SenderID || d.Text != msg.Text {
+					t.Errorf("decision %+v does not describe the message", d)
+				}
+			}
+		})
+	}
+}
+
+func TestWordlistMask(t *testing.T) {
+	tests := []struct {
+		name     string
+		words    []string
+		patterns []string
+		text     string
+		want     string
+	}{
+		{
+			name:  "whole words only",
+			words: []string{"darn"},
+			text:  "Darn it, darnation",
+			want:  "**** it, darnation",
+		},
+		{
+			name:  "multi-byte words",
+			words: []string{"ärger", "дурак"},
+			text:  "Kein Ärger, дурак! Ärgernis",
+			want:  "Kein *****, *****! Ärgernis",
+		},
+		{
+			name:  "emoji next to a word",
+			words: []string{"żółw"},
+			text:  "🐢żółw🐢",
+			want:  "🐢****🐢",
+		},
+		{
+			name:     "pattern keeps spaces",
+			patterns: []string{`bad\s+word`},
+			text:     "a BAD  word here",
+			want:     "a ***  **** here",
+		},
+		{
+			name:     "overlapping matches",
+			words:    []string{"spam"},
+			patterns: []string{`am\s*eggs`},
+			text:     "spam eggs",
+			want:     "**** ****",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patterns []*regexp.Regexp
+			for _, p := range tt.patterns {
+				patterns = append(patterns, regexp.MustCompile("(?i)"+p))
+			}
+			f := NewWordlistFilter(tt.words, patterns, Mask)
+
+			d, err := f.Check(context.Background(), Message{Text: tt.text})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Action != Mask || d.Text != tt.want {
+				t.Errorf("Check() = %v %q, want mask %q", d.Action, d.Text, tt.want)
+			}
+			if utf8.RuneCountInString(d.Text) != utf8.RuneCountInString(tt.text) {
+				t.Errorf("masking changed the rune count of %q", tt.text)
+			}
+		})
+	}
+}
+
+func TestWordlistActions(t *testing.T) {
+	for _, action := range []Action{Flag, Reject} {
+		f := NewWordlistFilter([]string{"darn"}, nil, action)
+		d, err := f.Check(context.Background(), Message{Text: "oh darn"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Action != action || d.Text != "" {
+			t.Errorf("Check() = %+v, want %v without text", d, action)
+		}
+	}
+}
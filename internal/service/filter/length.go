@@ -0,0 +1,33 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// LengthFilter rejects messages over a length or line count stricter than
+// the hard limit every message is held to. A zero limit is not checked.
+type LengthFilter struct {
+	maxRunes int
+	maxLines int
+}
+
+func NewLengthFilter(maxRunes, maxLines int) *LengthFilter {
+	return &LengthFilter{maxRunes: maxRunes, maxLines: maxLines}
+}
+
+func (f *LengthFilter) Name() string {
+	return "length"
+}
+
+func (f *LengthFilter) Check(ctx context.Context, msg Message) (Decision, error) {
+	if f.maxRunes > 0 && utf8.RuneCountInString(msg.Text) > f.maxRunes {
+		return Decision{Action: Reject, Reason: fmt.Sprintf("longer than %d characters", f.maxRunes)}, nil
+	}
+	if f.maxLines > 0 && strings.Count(msg.Text, "\n")+1 > f.maxLines {
+		return Decision{Action: Reject, Reason: fmt.Sprintf("more than %d lines", f.maxLines)}, nil
+	}
+	return Decision{Action: Allow}, nil
+}
@@ -0,0 +1,110 @@
+package filter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+const repeatKeyPrefix = "spam:repeat:"
+
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://|\bwww\.`)
+
+type SpamOptions struct {
+	// Window is how long a message counts towards MaxRepeats.
+	Window time.Duration
+	// MaxRepeats is how many times a user may send the same text, to any
+	// chats, within Window.
+	MaxRepeats int
+	// MaxLinks is the number of links a single message may contain.
+	MaxLinks int
+}
+
+// SpamFilter rejects a user repeating the same message over and over and
+// messages flooded with links. Repeats are counted in Redis so that every
+// server instance sees them. Only messages that were accepted and stored
+// count, each text once per send.
+type SpamFilter struct {
+	redis *redis.Client
+	opts  SpamOptions
+}
+
+func NewSpamFilter(redisClient *redis.Client, opts SpamOptions) *SpamFilter {
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+	if opts.MaxRepeats <= 0 {
+		opts.MaxRepeats = 3
+	}
+	if opts.MaxLinks <= 0 {
+		opts.MaxLinks = 5
+	}
+	return &SpamFilter{redis: redisClient, opts: opts}
+}
+
+func (f *SpamFilter) Name() string {
+	return "spam"
+}
+
+func (f *SpamFilter) Check(ctx context.Context, msg Message) (Decision, error) {
+	if countLinks(msg) > f.opts.MaxLinks {
+		return Decision{Action: Reject, Reason: fmt.Sprintf("more than %d links", f.opts.MaxLinks)}, nil
+	}
+
+	count, err := f.redis.Get(ctx, repeatKey(msg)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return Decision{}, fmt.Errorf("failed to read repeats: %w", err)
+	}
+
+	if count >= int64(f.opts.MaxRepeats) {
+		return Decision{Action: Reject, Reason: "same message sent too many times"}, nil
+	}
+	return Decision{Action: Allow}, nil
+}
+
+// Track counts each distinct text among msgs once.
+func (f *SpamFilter) Track(ctx context.Context, msgs []Message) error {
+	seen := make(map[string]bool, len(msgs))
+	_, err := f.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, msg := range msgs {
+			key := repeatKey(msg)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			pipe.Incr(ctx, key)
+			pipe.ExpireNX(ctx, key, f.opts.Window)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to count repeats: %w", err)
+	}
+	return nil
+}
+
+func repeatKey(msg Message) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.Join(strings.Fields(msg.Text), " "))))
+	return repeatKeyPrefix + strconv.FormatInt(msg.SenderID, 10) + ":" + hex.EncodeToString(sum[:16])
+}
+
+// countLinks counts links in the text and link entities that point
+// somewhere not visible in the text.
+func countLinks(msg Message) int {
+	n := len(linkPattern.FindAllStringIndex(msg.Text, -1))
+	for _, e := range msg.Entities {
+		if e.Type == models.EntityLink && !strings.Contains(msg.Text, e.URL) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,141 @@
+package filter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// WordlistFilter catches blocked words, matched as whole words regardless
+// of case, and regular expressions matched anywhere in the text.
+type WordlistFilter struct {
+	words    map[string]bool
+	patterns []*regexp.Regexp
+	action   Action
+}
+
+func NewWordlistFilter(words []string, patterns []*regexp.Regexp, action Action) *WordlistFilter {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			set[w] = true
+		}
+	}
+	return &WordlistFilter{words: set, patterns: patterns, action: action}
+}
+
+// LoadWordlist reads a wordlist file with one entry per line. Lines that
+// start with "re:" are case-insensitive regular expressions; blank lines
+// and lines starting with "#" are ignored.
+func LoadWordlist(path string) ([]string, []*regexp.Regexp, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	var patterns []*regexp.Regexp
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		if expr, ok := strings.CutPrefix(entry, "re:"); ok {
+			re, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			patterns = append(patterns, re)
+			continue
+		}
+		words = append(words, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return words, patterns, nil
+}
+
+func (f *WordlistFilter) Name() string {
+	return "wordlist"
+}
+
+func (f *WordlistFilter) Check(ctx context.Context, msg Message) (Decision, error) {
+	matches := f.matches(msg.Text)
+	if len(matches) == 0 {
+		return Decision{Action: Allow}, nil
+	}
+
+	decision := Decision{Action: f.action, Reason: "contains blocked words"}
+	if f.action == Mask {
+		decision.Text = maskRanges(msg.Text, matches)
+	}
+	return decision, nil
+}
+
+// matches returns the byte ranges of blocked words and pattern matches.
+func (f *WordlistFilter) matches(text string) [][2]int {
+	var ranges [][2]int
+
+	if len(f.words) > 0 {
+		start := -1
+		for i, r := range text + " " {
+			isWordRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+			switch {
+			case isWordRune && start < 0:
+				start = i
+			case !isWordRune && start >= 0:
+				if f.words[strings.ToLower(text[start:i])] {
+					ranges = append(ranges, [2]int{start, i})
+				}
+				start = -1
+			}
+		}
+	}
+
+	for _, re := range f.patterns {
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			if loc[0] < loc[1] {
+				ranges = append(ranges, [2]int{loc[0], loc[1]})
+			}
+		}
+	}
+
+	return ranges
+}
+
+// maskRanges replaces every non-space rune inside ranges with an asterisk,
+// one for one, so the rune count is unchanged.
+func maskRanges(text string, ranges [][2]int) string {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+	var b strings.Builder
+	b.Grow(len(text))
+	next := 0
+	for i, r := range text {
+		for next < len(ranges) && ranges[next][1] <= i {
+			next++
+		}
+		masked := false
+		for k := next; k < len(ranges) && ranges[k][0] <= i; k++ {
+			if i < ranges[k][1] {
+				masked = true
+				break
+			}
+		}
+		if masked && !unicode.IsSpace(r) {
+			b.WriteByte('*')
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,382 @@
+package moderation
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/christmas-fire/nexus/internal/models"
+	"github.com/christmas-fire/nexus/internal/repository/chat"
+	"github.com/christmas-fire/nexus/internal/repository/moderation"
+	"github.com/christmas-fire/nexus/internal/service/events"
+	"github.com/christmas-fire/nexus/internal/service/filter"
+)
+
+var (
+	ErrNotModerator        = errors.New("moderator role required")
+	ErrPermissionDenied    = errors.New("permission denied")
+	ErrNothingToReport     = errors.New("report must name a message or a user")
+	ErrCannotReportSelf    = errors.New("cannot report yourself")
+	ErrCannotSuspendSelf   = errors.New("cannot suspend yourself")
+	ErrInvalidReason       = errors.New("invalid report reason")
+	ErrDetailsTooLong      = errors.New("report details are too long")
+	ErrInvalidReportStatus = errors.New("invalid report status")
+	ErrInvalidFilterAction = errors.New("invalid filter action")
+	ErrInvalidResolution   = errors.New("report can only be resolved or dismissed")
+	ErrInvalidSuspension   = errors.New("suspension must end in the future")
+	ErrInvalidPageToken    = errors.New("invalid page token")
+	ErrReportNotFound      = moderation.ErrReportNotFound
+	ErrAlreadyReported     = moderation.ErrAlreadyReported
+	ErrReportClosed        = moderation.ErrReportClosed
+	ErrUserNotFound        = moderation.ErrUserNotFound
+	ErrMessageNotFound     = chat.ErrMessageNotFound
+)
+
+const (
+	EventMessageDeleted = "message_deleted"
+
+	maxReportDetails = 1000
+
+	defaultReportsPageSize = 50
+	maxReportsPageSize     = 200
+)
+
+// reportReasons are the reasons a user can pick from when filing a report.
+var reportReasons = map[string]bool{
+	"spam":           true,
+	"harassment":     true,
+	"hate_speech":    true,
+	"violence":       true,
+	"sexual_content": true,
+	"other":          true,
+}
+
+// ReportInput names what is being reported: a message (ChatID and
+// MessageID) or, when MessageID is empty, the user UserID.
+type ReportInput struct {
+	ChatID    string
+	MessageID string
+	UserID    int64
+	Reason    string
+	Details   string
+}
+
+type ModerationService struct {
+	moderationRepo moderation.ModerationRepository
+	chatRepo       chat.ChatRepository
+	events         *events.Publisher
+}
+
+func NewModerationService(moderationRepo moderation.ModerationRepository, chatRepo chat.ChatRepository, publisher *events.Publisher) *ModerationService {
+	return &ModerationService{moderationRepo: moderationRepo, chatRepo: chatRepo, events: publisher}
+}
+
+// Report files a report for the moderation queue. A reported message is
+// copied into the report; only members of its chat can report it.
+func (s *ModerationService) Report(ctx context.Context, reporterID int64, input ReportInput) (moderation.Report, error) {
+	if !reportReasons[input.Reason] {
+		return moderation.Report{}, ErrInvalidReason
+	}
+	details := strings.TrimSpace(input.Details)
+	if utf8.RuneCountInString(details) > maxReportDetails {
+		return moderation.Report{}, ErrDetailsTooLong
+	}
+
+	report := moderation.Report{
+		ReporterID: reporterID,
+		Reason:     input.Reason,
+		Details:    details,
+	}
+
+	switch {
+	case input.MessageID != "":
+		isMember, err := s.chatRepo.IsMember(ctx, input.ChatID, reporterID)
+		if err != nil {
+			return moderation.Report{}, err
+		}
+		if !isMember {
+			return moderation.Report{}, ErrPermissionDenied
+		}
+
+		msg, err := s.chatRepo.GetMessage(ctx, input.ChatID, input.MessageID)
+		if err != nil {
+			return moderation.Report{}, err
+		}
+		report.ReportedUserID = msg.SenderID
+		report.ChatID = &msg.ChatID
+		report.MessageID = &msg.ID
+		report.MessageText = &msg.Text
+	case input.UserID != 0:
+		report.ReportedUserID = input.UserID
+	default:
+		return moderation.Report{}, ErrNothingToReport
+	}
+
+	if report.ReportedUserID == reporterID {
+		return moderation.Report{}, ErrCannotReportSelf
+	}
+
+	return s.moderationRepo.CreateReport(ctx, report)
+}
+
+// IsSuspended reports whether userID is currently suspended. The auth
+// interceptors and the WebSocket gateway call it on every request.
+func (s *ModerationService) IsSuspended(ctx context.Context, userID int64) (bool, error) {
+	return s.moderationRepo.IsSuspended(ctx, userID)
+}
+
+func (s *ModerationService) requireModerator(ctx context.Context, userID int64) error {
+	isModerator, err := s.moderationRepo.IsModerator(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !isModerator {
+		return ErrNotModerator
+	}
+	return nil
+}
+
+// ListReports returns a page of the moderation queue, oldest first, and the
+// token for the next page. An empty status lists every report.
+func (s *ModerationService) ListReports(ctx context.Context, moderatorID int64, status string, pageSize int, pageToken string) ([]moderation.Report, string, error) {
+	if err := s.requireModerator(ctx, moderatorID); err != nil {
+		return nil, "", err
+	}
+
+	switch status {
+	case "", moderation.ReportOpen, moderation.ReportResolved, moderation.ReportDismissed:
+	default:
+		return nil, "", ErrInvalidReportStatus
+	}
+
+	if pageSize <= 0 {
+		pageSize = defaultReportsPageSize
+	}
+	if pageSize > maxReportsPageSize {
+		pageSize = maxReportsPageSize
+	}
+
+	var after *moderation.ReportCursor
+	if pageToken != "" {
+		cursor, err := decodeReportCursor(pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		after = cursor
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	reports, err := s.moderationRepo.ListReports(ctx, status, after, pageSize+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextPageToken string
+	if len(reports) > pageSize {
+		reports = reports[:pageSize]
+		last := reports[len(reports)-1]
+		nextPageToken = encodeReportCursor(moderation.ReportCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	return reports, nextPageToken, nil
+}
+
+func encodeReportCursor(c moderation.ReportCursor) string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixMicro(), 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeReportCursor(token string) (*moderation.ReportCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	micros, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return nil, ErrInvalidPageToken
+	}
+
+	usec, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	return &moderation.ReportCursor{CreatedAt: time.UnixMicro(usec), ID: id}, nil
+}
+
+// ListFilterDecisions returns a page of content filter decisions, newest
+// first, and the token for the next page. An empty action lists them all.
+func (s *ModerationService) ListFilterDecisions(ctx context.Context, moderatorID int64, action string, pageSize int, pageToken string) ([]models.FilterDecision, string, error) {
+	if err := s.requireModerator(ctx, moderatorID); err != nil {
+		return nil, "", err
+	}
+
+	if action != "" {
+		if _, err := filter.ParseAction(action); err != nil {
+			return nil, "", ErrInvalidFilterAction
+		}
+	}
+
+	if pageSize <= 0 {
+		pageSize = defaultReportsPageSize
+	}
+	if pageSize > maxReportsPageSize {
+		pageSize = maxReportsPageSize
+	}
+
+	var beforeID int64
+	if pageToken != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(pageToken)
+		if err != nil {
+			return nil, "", ErrInvalidPageToken
+		}
+		beforeID, err = strconv.ParseInt(string(raw), 10, 64)
+		if err != nil || beforeID <= 0 {
+			return nil, "", ErrInvalidPageToken
+		}
+	}
+
+	decisions, err := s.moderationRepo.ListFilterDecisions(ctx, action, beforeID, pageSize+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextPageToken string
+	if len(decisions) > pageSize {
+		decisions = decisions[:pageSize]
+		last := decisions[len(decisions)-1]
+		nextPageToken = base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(last.ID, 10)))
+	}
+
+	return decisions, nextPageToken, nil
+}
+
+// ResolveReport closes an open report as resolved or dismissed.
+func (s *ModerationService) ResolveReport(ctx context.Context, moderatorID int64, reportID, status, note string) (moderation.Report, error) {
+	if status != moderation.ReportResolved && status != moderation.ReportDismissed {
+		return moderation.Report{}, ErrInvalidResolution
+	}
+
+	if err := s.requireModerator(ctx, moderatorID); err != nil {
+		return moderation.Report{}, err
+	}
+
+	report, err := s.moderationRepo.CloseReport(ctx, reportID, moderatorID, status, strings.TrimSpace(note))
+	if err != nil {
+		return moderation.Report{}, err
+	}
+
+	s.logAction(ctx, moderation.Action{
+		ModeratorID:  moderatorID,
+		Action:       moderation.ActionResolveReport,
+		TargetUserID: &report.ReportedUserID,
+		ReportID:     &report.ID,
+		Note:         status,
+	})
+
+	return report, nil
+}
+
+// DeleteMessage removes any message and tells the chat's members it is
+// gone. reportID, when set, ties the action to the report that prompted it.
+func (s *ModerationService) DeleteMessage(ctx context.Context, moderatorID int64, chatID, messageID string, reportID *string) error {
+	if err := s.requireModerator(ctx, moderatorID); err != nil {
+		return err
+	}
+
+	msg, err := s.chatRepo.GetMessage(ctx, chatID, messageID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.chatRepo.DeleteMessage(ctx, chatID, messageID); err != nil {
+		return err
+	}
+
+	s.publish(ctx, models.Event{Type: EventMessageDeleted, ChatID: chatID}, models.MessageDeleted{
+		ChatID:    chatID,
+		MessageID: messageID,
+	})
+
+	s.logAction(ctx, moderation.Action{
+		ModeratorID:  moderatorID,
+		Action:       moderation.ActionDeleteMessage,
+		TargetUserID: &msg.SenderID,
+		MessageID:    &messageID,
+		ReportID:     reportID,
+	})
+
+	return nil
+}
+
+// SuspendUser locks userID out until the given time, or indefinitely when
+// until is nil. The user's open WebSocket sessions are closed and further
+// gRPC calls are rejected by the auth interceptors.
+func (s *ModerationService) SuspendUser(ctx context.Context, moderatorID, userID int64, until *time.Time, reason string, reportID *string) error {
+	if userID == moderatorID {
+		return ErrCannotSuspendSelf
+	}
+	if until != nil && !until.After(time.Now()) {
+		return ErrInvalidSuspension
+	}
+
+	if err := s.requireModerator(ctx, moderatorID); err != nil {
+		return err
+	}
+
+	reason = strings.TrimSpace(reason)
+	if err := s.moderationRepo.SuspendUser(ctx, userID, until, reason); err != nil {
+		return err
+	}
+
+	s.publish(ctx, models.Event{Type: models.EventAccountSuspended, UserIDs: []int64{userID}}, models.AccountSuspended{
+		Until:  until,
+		Reason: reason,
+	})
+
+	s.logAction(ctx, moderation.Action{
+		ModeratorID:  moderatorID,
+		Action:       moderation.ActionSuspendUser,
+		TargetUserID: &userID,
+		ReportID:     reportID,
+		Note:         reason,
+	})
+
+	return nil
+}
+
+func (s *ModerationService) UnsuspendUser(ctx context.Context, moderatorID, userID int64) error {
+	if err := s.requireModerator(ctx, moderatorID); err != nil {
+		return err
+	}
+
+	if err := s.moderationRepo.UnsuspendUser(ctx, userID); err != nil {
+		return err
+	}
+
+	s.logAction(ctx, moderation.Action{
+		ModeratorID:  moderatorID,
+		Action:       moderation.ActionUnsuspendUser,
+		TargetUserID: &userID,
+	})
+
+	return nil
+}
+
+// logAction records a moderation action in the audit log. The action has
+// already taken effect, so a failure is only logged.
+func (s *ModerationService) logAction(ctx context.Context, action moderation.Action) {
+	if err := s.moderationRepo.LogAction(ctx, action); err != nil {
+		log.Printf("failed to log moderation action %s by user %d: %v", action.Action, action.ModeratorID, err)
+	}
+}
+
+func (s *ModerationService) publish(ctx context.Context, event models.Event, payload interface{}) {
+	s.events.Publish(ctx, event, payload)
+}
@@ -0,0 +1,343 @@
+package preview
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/christmas-fire/nexus/internal/models"
+	"golang.org/x/net/html"
+)
+
+var (
+	ErrUnsupportedURL     = errors.New("url is not eligible for a preview")
+	ErrForbiddenAddress   = errors.New("url resolves to a forbidden address")
+	ErrUnsupportedContent = errors.New("response is not an html page")
+	ErrNoMetadata         = errors.New("page has no preview metadata")
+)
+
+const (
+	maxTitleLength       = 256
+	maxDescriptionLength = 1024
+	maxRedirects         = 3
+)
+
+type Options struct {
+	// Timeout bounds the whole fetch including redirects and oEmbed lookup.
+	Timeout time.Duration
+	// MaxBodySize is the number of bytes read from any response.
+	MaxBodySize int64
+	UserAgent   string
+	// AllowPrivateNetworks disables the SSRF guard. Only meant for tests
+	// that run the target page on a loopback httptest server.
+	AllowPrivateNetworks bool
+}
+
+// Unfurler fetches OpenGraph and oEmbed metadata for a URL. Connections to
+// loopback, private, link-local and other non-public addresses are refused
+// at dial time, so redirects and DNS rebinding cannot bypass the check.
+type Unfurler struct {
+	client      *http.Client
+	timeout     time.Duration
+	maxBodySize int64
+	userAgent   string
+}
+
+func NewUnfurler(opts Options) *Unfurler {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 512 << 10
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = "NexusBot/1.0 (+link preview)"
+	}
+
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	if !opts.AllowPrivateNetworks {
+		dialer.Control = guardAddress
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   opts.Timeout,
+		ResponseHeaderTimeout: opts.Timeout,
+		MaxIdleConns:          16,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if !isHTTPURL(req.URL) {
+				return ErrUnsupportedURL
+			}
+			return nil
+		},
+	}
+
+	return &Unfurler{
+		client:      client,
+		timeout:     opts.Timeout,
+		maxBodySize: opts.MaxBodySize,
+		userAgent:   opts.UserAgent,
+	}
+}
+
+func (u *Unfurler) Unfurl(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || !isHTTPURL(target) {
+		return nil, ErrUnsupportedURL
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, u.timeout)
+	defer cancel()
+
+	body, finalURL, err := u.fetch(ctx, target.String(), "text/html", "application/xhtml+xml")
+	if err != nil {
+		return nil, err
+	}
+
+	meta := parseHTMLMeta(body)
+	preview := &models.LinkPreview{
+		URL:         rawURL,
+		Title:       firstNonEmpty(meta["og:title"], meta["twitter:title"], meta["title"]),
+		Description: firstNonEmpty(meta["og:description"], meta["twitter:description"], meta["description"]),
+		ImageURL:    firstNonEmpty(meta["og:image"], meta["og:image:url"], meta["twitter:image"]),
+		SiteName:    meta["og:site_name"],
+	}
+
+	if oembedHref := meta["oembed"]; oembedHref != "" {
+		if oembedURL, err := finalURL.Parse(oembedHref); err == nil && isHTTPURL(oembedURL) {
+			u.mergeOEmbed(ctx, oembedURL.String(), preview)
+		}
+	}
+
+	preview.Title = clean(preview.Title, maxTitleLength)
+	preview.Description = clean(preview.Description, maxDescriptionLength)
+	preview.SiteName = clean(preview.SiteName, maxTitleLength)
+	preview.ImageURL = resolveImageURL(finalURL, preview.ImageURL)
+
+	if preview.Title == "" && preview.Description == "" && preview.ImageURL == "" {
+		return nil, ErrNoMetadata
+	}
+
+	return preview, nil
+}
+
+type oembedResponse struct {
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	ProviderName string `json:"provider_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+// mergeOEmbed fills fields the page's own metadata left empty. oEmbed is
+// best-effort: any failure keeps the OpenGraph result.
+func (u *Unfurler) mergeOEmbed(ctx context.Context, oembedURL string, preview *models.LinkPreview) {
+	body, _, err := u.fetch(ctx, oembedURL, "application/json", "text/javascript")
+	if err != nil {
+		return
+	}
+
+	var resp oembedResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return
+	}
+
+	preview.Title = firstNonEmpty(preview.Title, resp.Title)
+	preview.Description = firstNonEmpty(preview.Description, resp.AuthorName)
+	preview.SiteName = firstNonEmpty(preview.SiteName, resp.ProviderName)
+	preview.ImageURL = firstNonEmpty(preview.ImageURL, resp.ThumbnailURL)
+}
+
+func (u *Unfurler) fetch(ctx context.Context, target string, contentTypes ...string) ([]byte, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, nil, ErrUnsupportedURL
+	}
+	req.Header.Set("User-Agent", u.userAgent)
+	req.Header.Set("Accept", strings.Join(contentTypes, ", "))
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("failed to fetch %s: unexpected status %d", target, resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !contains(contentTypes, mediaType) {
+		return nil, nil, ErrUnsupportedContent
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, u.maxBodySize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", target, err)
+	}
+
+	return body, resp.Request.URL, nil
+}
+
+// parseHTMLMeta collects preview-related tags from the document head. Keys
+// are OpenGraph/Twitter property names, plus "title", "description" and
+// "oembed" for the JSON oEmbed discovery link.
+func parseHTMLMeta(body []byte) map[string]string {
+	meta := make(map[string]string)
+	z := html.NewTokenizer(strings.NewReader(string(body)))
+	inTitle := false
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return meta
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			switch tok.Data {
+			case "body":
+				return meta
+			case "title":
+				inTitle = true
+			case "meta":
+				key := strings.ToLower(firstNonEmpty(attr(tok, "property"), attr(tok, "name")))
+				if key != "" && meta[key] == "" {
+					meta[key] = attr(tok, "content")
+				}
+			case "link":
+				if strings.EqualFold(attr(tok, "rel"), "alternate") &&
+					strings.EqualFold(attr(tok, "type"), "application/json+oembed") {
+					meta["oembed"] = attr(tok, "href")
+				}
+			}
+
+		case html.EndTagToken:
+			tok := z.Token()
+			if tok.Data == "head" {
+				return meta
+			}
+			inTitle = false
+
+		case html.TextToken:
+			if inTitle && meta["title"] == "" {
+				meta["title"] = string(z.Text())
+			}
+		}
+	}
+}
+
+func guardAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return ErrForbiddenAddress
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+var nonPublicNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+	"64:ff9b::/96",
+)
+
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range nonPublicNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func isHTTPURL(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil
+}
+
+func resolveImageURL(base *url.URL, raw string) string {
+	if raw == "" {
+		return ""
+	}
+	ref, err := base.Parse(strings.TrimSpace(raw))
+	if err != nil || !isHTTPURL(ref) {
+		return ""
+	}
+	return ref.String()
+}
+
+func clean(s string, maxRunes int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.ToValidUTF8(s, "")
+	if utf8.RuneCountInString(s) > maxRunes {
+		s = string([]rune(s)[:maxRunes-1]) + "…"
+	}
+	return s
+}
+
+func attr(tok html.Token, name string) string {
+	for _, a := range tok.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func contains(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
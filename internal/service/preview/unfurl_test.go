@@ -0,0 +1,88 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func servePage(t *testing.T, page string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, page)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestUnfurlOpenGraph(t *testing.T) {
+	srv := servePage(t, `<html><head>
+		<title>Fallback title</title>
+		<meta property="og:title" content="  Nexus   release notes ">
+		<meta property="og:description" content="What changed this week">
+		<meta property="og:image" content="/images/cover.png">
+		<meta property="og:site_name" content="Nexus">
+	</head><body><meta property="og:title" content="ignored"></body></html>`)
+
+	u := NewUnfurler(Options{AllowPrivateNetworks: true})
+	preview, err := u.Unfurl(context.Background(), srv.URL+"/post")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if preview.URL != srv.URL+"/post" {
+		t.Errorf("URL = %q", preview.URL)
+	}
+	if preview.Title != "Nexus release notes" {
+		t.Errorf("Title = %q", preview.Title)
+	}
+	if preview.Description != "What changed this week" {
+		t.Errorf("Description = %q", preview.Description)
+	}
+	if preview.ImageURL != srv.URL+"/images/cover.png" {
+		t.Errorf("ImageURL = %q", preview.ImageURL)
+	}
+	if preview.SiteName != "Nexus" {
+		t.Errorf("SiteName = %q", preview.SiteName)
+	}
+}
+
+func TestUnfurlReadsAtMostMaxBodySize(t *testing.T) {
+	padding := strings.Repeat("x", 4<<10)
+	srv := servePage(t, `<html><head>
+		<meta name="padding" content="`+padding+`">
+		<meta property="og:title" content="Past the limit">
+	</head></html>`)
+
+	u := NewUnfurler(Options{AllowPrivateNetworks: true, MaxBodySize: 1 << 10})
+	if _, err := u.Unfurl(context.Background(), srv.URL); !errors.Is(err, ErrNoMetadata) {
+		t.Errorf("Unfurl() error = %v, want %v", err, ErrNoMetadata)
+	}
+}
+
+func TestUnfurlRefusesPrivateAddresses(t *testing.T) {
+	srv := servePage(t, `<html><head><title>Internal</title></head></html>`)
+
+	u := NewUnfurler(Options{})
+	if _, err := u.Unfurl(context.Background(), srv.URL); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("Unfurl() error = %v, want %v", err, ErrForbiddenAddress)
+	}
+}
+
+func TestUnfurlRejectsOtherContent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("not a page"))
+	}))
+	defer srv.Close()
+
+	u := NewUnfurler(Options{AllowPrivateNetworks: true})
+	if _, err := u.Unfurl(context.Background(), srv.URL); !errors.Is(err, ErrUnsupportedContent) {
+		t.Errorf("Unfurl() error = %v, want %v", err, ErrUnsupportedContent)
+	}
+}
@@ -0,0 +1,160 @@
+package preview
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/christmas-fire/nexus/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	queueKey       = "link_previews"
+	cacheKeyPrefix = "link_preview:"
+	cacheTTL       = 24 * time.Hour
+	// negativeCacheTTL keeps pages without usable metadata from being
+	// fetched again for every message that links to them.
+	negativeCacheTTL = time.Hour
+	popTimeout       = 5 * time.Second
+)
+
+type Job struct {
+	ChatID    string `json:"chat_id"`
+	MessageID string `json:"message_id"`
+	URL       string `json:"url"`
+}
+
+// Enqueue schedules a preview for a freshly stored message.
+func Enqueue(ctx context.Context, rdb *redis.Client, job Job) error {
+	jobBytes, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return rdb.LPush(ctx, queueKey, jobBytes).Err()
+}
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `]+`)
+
+// FindURL returns the first link in a message: an explicit link entity if
+// there is one, otherwise the first http(s) URL in the text.
+func FindURL(text string, entities []models.Entity) string {
+	for _, e := range entities {
+		if e.Type == models.EntityLink && (strings.HasPrefix(e.URL, "http://") || strings.HasPrefix(e.URL, "https://")) {
+			return e.URL
+		}
+	}
+	return strings.TrimRight(urlPattern.FindString(text), ".,;:!?)]}")
+}
+
+// Attacher stores a preview on a message and notifies the chat about it.
+type Attacher interface {
+	AttachLinkPreview(ctx context.Context, chatID, messageID string, preview models.LinkPreview) error
+}
+
+type Worker struct {
+	redis    *redis.Client
+	unfurler *Unfurler
+	attacher Attacher
+}
+
+func NewWorker(redisClient *redis.Client, unfurler *Unfurler, attacher Attacher) *Worker {
+	return &Worker{redis: redisClient, unfurler: unfurler, attacher: attacher}
+}
+
+// Run processes jobs with the given number of goroutines until ctx is done.
+// The queue lives in Redis, so several server replicas share the work.
+func (w *Worker) Run(ctx context.Context, concurrency int) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	for ctx.Err() == nil {
+		res, err := w.redis.BRPop(ctx, popTimeout, queueKey).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				log.Printf("failed to pop link preview job: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		var job Job
+		if err := json.Unmarshal([]byte(res[1]), &job); err != nil {
+			log.Printf("failed to unmarshal link preview job: %v", err)
+			continue
+		}
+
+		w.process(ctx, job)
+	}
+}
+
+func (w *Worker) process(ctx context.Context, job Job) {
+	preview, err := w.lookup(ctx, job.URL)
+	if err != nil {
+		log.Printf("failed to unfurl %s: %v", job.URL, err)
+		return
+	}
+	if preview == nil {
+		return
+	}
+
+	if err := w.attacher.AttachLinkPreview(ctx, job.ChatID, job.MessageID, *preview); err != nil {
+		log.Printf("failed to attach link preview to message %s: %v", job.MessageID, err)
+	}
+}
+
+// lookup returns a cached preview or unfurls the URL and caches the result.
+// A nil preview with a nil error means the page has nothing to show.
+func (w *Worker) lookup(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	sum := sha256.Sum256([]byte(rawURL))
+	cacheKey := cacheKeyPrefix + hex.EncodeToString(sum[:])
+
+	cached, err := w.redis.Get(ctx, cacheKey).Bytes()
+	if err == nil {
+		if len(cached) == 0 {
+			return nil, nil
+		}
+		var preview models.LinkPreview
+		if err := json.Unmarshal(cached, &preview); err == nil {
+			return &preview, nil
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		log.Printf("failed to read link preview cache: %v", err)
+	}
+
+	preview, err := w.unfurler.Unfurl(ctx, rawURL)
+	if err != nil {
+		if errors.Is(err, ErrNoMetadata) || errors.Is(err, ErrUnsupportedContent) ||
+			errors.Is(err, ErrUnsupportedURL) || errors.Is(err, ErrForbiddenAddress) {
+			w.redis.Set(ctx, cacheKey, "", negativeCacheTTL)
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if previewBytes, err := json.Marshal(preview); err == nil {
+		w.redis.Set(ctx, cacheKey, previewBytes, cacheTTL)
+	}
+
+	return preview, nil
+}
@@ -0,0 +1,67 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	userRepo "github.com/christmas-fire/nexus/internal/repository/user"
+)
+
+var (
+	ErrUserNotFound     = userRepo.ErrUserNotFound
+	ErrCannotBlockSelf  = errors.New("cannot block yourself")
+	ErrEmptySearchQuery = errors.New("search query cannot be empty")
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 50
+)
+
+type UserService struct {
+	userRepo userRepo.UserRepository
+}
+
+func NewUserService(repo userRepo.UserRepository) *UserService {
+	return &UserService{userRepo: repo}
+}
+
+func (s *UserService) GetPrivacySettings(ctx context.Context, userID int64) (userRepo.PrivacySettings, error) {
+	return s.userRepo.GetPrivacySettings(ctx, userID)
+}
+
+func (s *UserService) UpdatePrivacySettings(ctx context.Context, userID int64, settings userRepo.PrivacySettings) error {
+	return s.userRepo.UpdatePrivacySettings(ctx, userID, settings)
+}
+
+func (s *UserService) BlockUser(ctx context.Context, blockerID, blockedID int64) error {
+	if blockerID == blockedID {
+		return ErrCannotBlockSelf
+	}
+	return s.userRepo.BlockUser(ctx, blockerID, blockedID)
+}
+
+func (s *UserService) UnblockUser(ctx context.Context, blockerID, blockedID int64) error {
+	return s.userRepo.UnblockUser(ctx, blockerID, blockedID)
+}
+
+func (s *UserService) ListBlocked(ctx context.Context, userID int64) ([]userRepo.BlockedUser, error) {
+	return s.userRepo.ListBlocked(ctx, userID)
+}
+
+func (s *UserService) SearchUsers(ctx context.Context, userID int64, query string, pageSize int) ([]userRepo.UserSummary, error) {
+	query = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(query), "@"))
+	if query == "" {
+		return nil, ErrEmptySearchQuery
+	}
+
+	if pageSize <= 0 {
+		pageSize = defaultSearchPageSize
+	}
+	if pageSize > maxSearchPageSize {
+		pageSize = maxSearchPageSize
+	}
+
+	return s.userRepo.SearchUsers(ctx, userID, query, pageSize)
+}
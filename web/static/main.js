@@ -1,6 +1,12 @@
 let socket = null;
 let currentChatID = null;
 let currentUserID = null;
+const drafts = {};
+let draftTimer = null;
+let nextRequestID = 1;
+// lastSeq is the sequence number of the last event received, presented to
+// the server to catch up after a reconnect.
+let lastSeq = 0;
 
 function showLoginView() {
     document.getElementById("login-view").classList.remove("d-none");
@@ -25,6 +31,7 @@ async function handleLogin(event) {
         if (!response.ok) throw new Error(await response.text());
         const data = await response.json();
         localStorage.setItem("authToken", data.access_token);
+        lastSeq = 0;
         connectWebSocket(data.access_token);
     } catch (error) {
         console.error("Login error:", error);
@@ -32,33 +39,66 @@ async function handleLogin(event) {
     }
 }
 
-function connectWebSocket(token) {
+// connectWebSocket authenticates the upgrade with a short-lived ticket, so
+// the token never appears in the URL; the server greets with auth_status.
+async function connectWebSocket(token) {
     if (!token) return;
-    socket = new WebSocket(`ws://${window.location.host}/ws`);
-    socket.onopen = () => sendMessageToServer("auth", { token });
+    let ticket;
+    try {
+        const response = await fetch("/api/v1/ws-ticket", {
+            method: "POST",
+            headers: { "Authorization": `Bearer ${token}` },
+        });
+        if (response.status === 401 || response.status === 403) {
+            localStorage.removeItem("authToken");
+            showLoginView();
+            return;
+        }
+        if (!response.ok) throw new Error(await response.text());
+        ticket = (await response.json()).ticket;
+    } catch (error) {
+        console.error("WebSocket ticket error:", error);
+        setTimeout(() => connectWebSocket(localStorage.getItem("authToken")), 2000);
+        return;
+    }
+    socket = new WebSocket(`ws://${window.location.host}/ws?ticket=${encodeURIComponent(ticket)}`);
     socket.onmessage = handleSocketMessage;
     socket.onerror = (error) => console.error("WebSocket error:", error);
     socket.onclose = () => {
         socket = null;
-        showLoginView();
+        if (localStorage.getItem("authToken")) {
+            setTimeout(() => connectWebSocket(localStorage.getItem("authToken")), 2000);
+        } else {
+            showLoginView();
+        }
     };
 }
 
+// sendMessageToServer returns the request id the server echoes on replies.
 function sendMessageToServer(type, payload) {
     if (socket && socket.readyState === WebSocket.OPEN) {
-        socket.send(JSON.stringify({ type, payload }));
+        const id = String(nextRequestID++);
+        socket.send(JSON.stringify({ id, type, payload }));
+        return id;
     }
+    return null;
 }
 
 function handleSocketMessage(event) {
     const msg = JSON.parse(event.data);
+    if (msg.seq) lastSeq = Math.max(lastSeq, msg.seq);
     switch (msg.type) {
         case "auth_status":
             if (msg.payload.success) {
                 const tokenPayload = JSON.parse(atob(localStorage.getItem("authToken").split('.')[1]));
                 currentUserID = parseInt(tokenPayload.sub, 10);
                 showChatView();
-                sendMessageToServer("get_my_chats", {});
+                if (lastSeq > 0) {
+                    sendMessageToServer("resume", { last_seq: lastSeq });
+                } else {
+                    lastSeq = msg.payload.seq || 0;
+                    sendMessageToServer("get_my_chats", {});
+                }
             } else {
                 localStorage.removeItem("authToken");
                 showLoginView();
@@ -71,7 +111,32 @@ function handleSocketMessage(event) {
             renderChatHistory(msg.payload);
             break;
         case "new_message":
-            if (msg.payload.chat_id === currentChatID) addMessageToChat(msg.payload);
+            if (msg.payload.chat_id === currentChatID && !document.querySelector(`#messages-container [data-message-id="${CSS.escape(msg.payload.id)}"]`)) {
+                addMessageToChat(msg.payload);
+            }
+            break;
+        case "resync_required":
+            lastSeq = msg.payload.seq;
+            sendMessageToServer("get_my_chats", {});
+            if (currentChatID) sendMessageToServer("get_chat_history", { chat_id: currentChatID });
+            break;
+        case "draft_updated":
+            drafts[msg.payload.chat_id] = msg.payload.text;
+            if (msg.payload.chat_id === currentChatID) document.getElementById("message-input").value = msg.payload.text;
+            break;
+        case "messages_expired":
+            if (msg.payload.chat_id === currentChatID) (msg.payload.message_ids || []).forEach(removeMessage);
+            break;
+        case "error":
+            console.error(`Request ${msg.id || "?"} failed: ${msg.payload.code}: ${msg.payload.message}`);
+            if (msg.payload.code !== "internal") alert(msg.payload.message);
+            break;
+        case "message_deleted":
+            if (msg.payload.chat_id === currentChatID) removeMessage(msg.payload.message_id);
+            break;
+        case "account_suspended":
+            localStorage.removeItem("authToken");
+            alert(msg.payload.reason ? `Your account has been suspended: ${msg.payload.reason}` : "Your account has been suspended.");
             break;
     }
 }
@@ -80,10 +145,17 @@ function renderChatsList(payload) {
     const chatsList = document.getElementById("chats-list");
     chatsList.innerHTML = "";
     (payload.chats || []).forEach(chat => {
+        drafts[chat.id] = chat.draft ? chat.draft.text : "";
         const a = document.createElement("a");
         a.href = "#";
         a.className = "list-group-item list-group-item-action";
         a.textContent = chat.name || `Chat ${chat.id.substring(0, 8)}`;
+        if (chat.last_message) {
+            const snippet = document.createElement("small");
+            snippet.className = "d-block text-muted text-truncate";
+            snippet.textContent = chat.last_message.snippet;
+            a.appendChild(snippet);
+        }
         a.addEventListener("click", (e) => handleChatSelection(e, chat));
         chatsList.appendChild(a);
     });
@@ -97,6 +169,7 @@ function handleChatSelection(event, chat) {
     document.getElementById("chat-title").textContent = chat.name || `Chat ${chat.id.substring(0, 8)}`;
     document.getElementById("messages-container").innerHTML = "";
     document.getElementById("message-input").disabled = false;
+    document.getElementById("message-input").value = drafts[currentChatID] || "";
     document.querySelector("#message-form button").disabled = false;
     document.getElementById("message-input").focus();
 
@@ -110,21 +183,91 @@ function renderChatHistory(payload) {
     });
 }
 
+const entityTags = {
+    bold: "strong",
+    italic: "em",
+    strikethrough: "s",
+    code: "code",
+    pre: "pre",
+    link: "a",
+    mention: "span",
+};
+
+// renderEntities builds DOM nodes for message text. Entities are nested or
+// disjoint ranges in code points; text is only ever inserted as text nodes.
+function renderEntities(text, entities) {
+    const chars = Array.from(text);
+    const sorted = (entities || []).slice().sort((a, b) => a.offset - b.offset || b.length - a.length);
+    let index = 0;
+
+    function build(parent, start, end) {
+        let cursor = start;
+        while (index < sorted.length && sorted[index].offset < end) {
+            const entity = sorted[index++];
+            const entityEnd = Math.min(entity.offset + entity.length, end);
+            if (entity.offset > cursor) {
+                parent.appendChild(document.createTextNode(chars.slice(cursor, entity.offset).join("")));
+            }
+            const el = document.createElement(entityTags[entity.type] || "span");
+            if (entity.type === "link" && /^(https?:|mailto:)/i.test(entity.url || "")) {
+                el.href = entity.url;
+                el.target = "_blank";
+                el.rel = "noopener noreferrer";
+            }
+            if (entity.type === "mention") el.className = "mention";
+            build(el, entity.offset, entityEnd);
+            parent.appendChild(el);
+            cursor = entityEnd;
+        }
+        if (end > cursor) {
+            parent.appendChild(document.createTextNode(chars.slice(cursor, end).join("")));
+        }
+    }
+
+    const root = document.createElement("p");
+    root.className = "mb-0";
+    root.style.whiteSpace = "pre-wrap";
+    build(root, 0, chars.length);
+    return root;
+}
+
 function addMessageToChat(msg) {
     const messagesContainer = document.getElementById("messages-container");
-    const messageElement = document.createElement("div");
     const isMyMessage = msg.sender_id === currentUserID;
     const alignClass = isMyMessage ? 'ms-auto' : 'me-auto';
-    const bgClass = isMyMessage ? 'bg-primary text-white' : 'bg-light text-dark border';
-    messageElement.innerHTML = `
-        <div class="card w-75 mb-2 ${alignClass}" style="max-width: 75%;">
-            <div class="card-body p-2">
-                <strong class="card-title">User ${msg.sender_id}</strong>
-                <p class="mb-0">${msg.text}</p>
-                <small class="text-white-50 text-end d-block">${new Date(msg.sent_at).toLocaleTimeString()}</small>
-            </div>
-        </div>`;
+
+    const card = document.createElement("div");
+    card.className = `card w-75 mb-2 ${alignClass}`;
+    card.style.maxWidth = "75%";
+
+    const body = document.createElement("div");
+    body.className = "card-body p-2";
+
+    const title = document.createElement("strong");
+    title.className = "card-title";
+    title.textContent = `User ${msg.sender_id}`;
+
+    const time = document.createElement("small");
+    time.className = "text-white-50 text-end d-block";
+    time.textContent = new Date(msg.sent_at).toLocaleTimeString();
+
+    body.append(title, renderEntities(msg.text, msg.entities), time);
+    card.appendChild(body);
+
+    const messageElement = document.createElement("div");
+    messageElement.dataset.messageId = msg.id;
+    messageElement.appendChild(card);
     messagesContainer.prepend(messageElement);
+
+    if (msg.expires_at) {
+        const delay = new Date(msg.expires_at) - Date.now();
+        setTimeout(() => messageElement.remove(), Math.max(delay, 0));
+    }
+}
+
+function removeMessage(messageID) {
+    const el = document.querySelector(`#messages-container [data-message-id="${CSS.escape(messageID)}"]`);
+    if (el) el.remove();
 }
 
 document.getElementById("login-form").addEventListener("submit", handleLogin);
@@ -134,11 +277,26 @@ document.getElementById("message-form").addEventListener("submit", (event) => {
     event.preventDefault();
     const text = document.getElementById("message-input").value;
     if (text && socket && currentChatID) {
-        sendMessageToServer("send_message", { chat_id: currentChatID, text: text });
+        sendMessageToServer("send_message", { chat_id: currentChatID, text: text, client_message_id: crypto.randomUUID() });
         document.getElementById("message-input").value = "";
+        saveDraft(currentChatID, "");
     }
 });
 
+function saveDraft(chatID, text) {
+    clearTimeout(draftTimer);
+    if (drafts[chatID] === text) return;
+    drafts[chatID] = text;
+    sendMessageToServer("save_draft", { chat_id: chatID, text });
+}
+
+document.getElementById("message-input").addEventListener("input", (event) => {
+    const chatID = currentChatID;
+    const text = event.target.value;
+    clearTimeout(draftTimer);
+    draftTimer = setTimeout(() => saveDraft(chatID, text), 500);
+});
+
 const savedToken = localStorage.getItem("authToken");
 if (savedToken) {
     connectWebSocket(savedToken);